@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+//maxIdentifierLength is the longest name of a table or a column of MySQL
+const maxIdentifierLength = 64
+
+//WithAdminToken sets a token of admin endpoints under /_admin/, they require
+//the Authorization: Bearer header with it. Admin endpoints are disabled without a token
+func WithAdminToken(token string) Option {
+	return func(l *Router) {
+		l.adminToken = token
+	}
+}
+
+//authorizeAdmin checks the token of an admin request and serves an error if it's wrong
+//or admin endpoints are disabled
+func (l *Router) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if l.adminToken == "" {
+		RespError{HTTPStatus: http.StatusForbidden, Error: "admin endpoints are disabled"}.serve(w, r, l)
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(l.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		RespError{HTTPStatus: http.StatusUnauthorized, Error: "unauthorized"}.serve(w, r, l)
+		return false
+	}
+	return true
+}
+
+//serveAdmin serves admin endpoints:
+//POST /_admin/reload reloads the schema, GET /_admin/diff compares it with another database,
+//POST /_admin/tables creates a table and DELETE /_admin/tables/$table drops it,
+//POST /_admin/$table/columns adds a column and DELETE /_admin/$table/columns/$column drops it,
+//GET /_admin/migrations lists migrations and POST /_admin/migrations/up|down|to/N runs them
+func serveAdmin(w http.ResponseWriter, r *http.Request, l *Router) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/_admin/"), "/")
+	isGet := r.Method == http.MethodGet
+	isPost := r.Method == http.MethodPost
+	isDelete := r.Method == http.MethodDelete
+	switch {
+	case isGet && len(segments) == 1 && segments[0] == "diff":
+		if l.authorizeAdmin(w, r) {
+			serveDiff(w, r, l)
+		}
+	case len(segments) == 1 && segments[0] == "reload":
+		//reload changes the state of the server, so it isn't served for safe methods
+		if !isPost {
+			w.Header().Set("Allow", http.MethodPost)
+			RespError{HTTPStatus: http.StatusMethodNotAllowed, Error: "Method not allowed"}.serve(w, r, l)
+			return
+		}
+		if l.authorizeAdmin(w, r) {
+			serveReload(w, r, l)
+		}
+	case isGet && len(segments) == 1 && segments[0] == "migrations":
+		if l.authorizeAdmin(w, r) {
+			serveMigrations(w, r, l, nil)
+		}
+	case isPost && segments[0] == "migrations" &&
+		((len(segments) == 2 && (segments[1] == "up" || segments[1] == "down")) || (len(segments) == 3 && segments[1] == "to")):
+		if l.authorizeAdmin(w, r) {
+			serveMigrations(w, r, l, segments[1:])
+		}
+	case isPost && len(segments) == 1 && segments[0] == "tables":
+		if l.authorizeAdmin(w, r) {
+			serveCreateTable(w, r, l)
+		}
+	case isDelete && len(segments) == 2 && segments[0] == "tables":
+		if l.authorizeAdmin(w, r) {
+			serveDropTable(w, r, l, segments[1])
+		}
+	case isPost && len(segments) == 2 && segments[1] == "columns":
+		if l.authorizeAdmin(w, r) {
+			serveAddColumn(w, r, l, segments[0])
+		}
+	case isDelete && len(segments) == 3 && segments[1] == "columns":
+		if l.authorizeAdmin(w, r) {
+			serveDropColumn(w, r, l, segments[0], segments[2])
+		}
+	default:
+		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w, r, l)
+	}
+}
+
+//columnDefinition is a column of a table created or changed by admin endpoints
+type columnDefinition struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	//Default is absent if the column has no default value, null is the NULL default
+	Default       json.RawMessage `json:"default"`
+	PrimaryKey    bool            `json:"primary_key"`
+	AutoIncrement bool            `json:"auto_increment"`
+}
+
+//tableDefinition is a table created by POST /_admin/tables
+type tableDefinition struct {
+	Name    string             `json:"name"`
+	Columns []columnDefinition `json:"columns"`
+}
+
+//definitionError is returned for invalid definitions of tables and columns
+type definitionError struct {
+	message string
+}
+
+func (defErr definitionError) Error() string {
+	return defErr.message
+}
+
+//isValidIdentifier reports whether the name of a table or a column consists of
+//letters, digits and underscores and doesn't start with a digit
+func isValidIdentifier(name string) bool {
+	if name == "" || len(name) > maxIdentifierLength || isDigit(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameStart(name[i]) && !isDigit(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//columnType returns the type of a column definition as MySQL spells it,
+//like varchar(255) or int unsigned, false is returned for unsupported types
+func columnType(typ string) (string, bool) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	unsigned := strings.HasSuffix(typ, " unsigned")
+	typ = strings.TrimSpace(strings.TrimSuffix(typ, " unsigned"))
+
+	base, args := typ, []string(nil)
+	if open := strings.IndexByte(typ, '('); open >= 0 {
+		if !strings.HasSuffix(typ, ")") {
+			return "", false
+		}
+		base = strings.TrimSpace(typ[:open])
+		for _, arg := range strings.Split(typ[open+1:len(typ)-1], ",") {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				return "", false
+			}
+			for i := 0; i < len(arg); i++ {
+				if !isDigit(arg[i]) {
+					return "", false
+				}
+			}
+			args = append(args, arg)
+		}
+	}
+
+	var minArgs, maxArgs int
+	canBeUnsigned := false
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		maxArgs, canBeUnsigned = 1, true
+	case "float", "double", "decimal":
+		maxArgs, canBeUnsigned = 2, true
+	case "char", "varchar", "binary", "varbinary":
+		minArgs, maxArgs = 1, 1
+	case "tinytext", "text", "mediumtext", "longtext", "tinyblob", "blob", "mediumblob", "longblob",
+		"date", "datetime", "timestamp", "time", "year", "json", "boolean":
+	default:
+		return "", false
+	}
+	if len(args) < minArgs || len(args) > maxArgs || (unsigned && !canBeUnsigned) {
+		return "", false
+	}
+	if len(args) > 0 {
+		base += "(" + strings.Join(args, ",") + ")"
+	}
+	if unsigned {
+		base += " unsigned"
+	}
+	return base, true
+}
+
+//defaultLiteral returns a literal of a JSON default value of a column
+func defaultLiteral(value json.RawMessage) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	switch casted := v.(type) {
+	case nil:
+		return "NULL", true
+	case bool:
+		if casted {
+			return "TRUE", true
+		}
+		return "FALSE", true
+	case json.Number:
+		return casted.String(), true
+	case string:
+		return quoteLiteral(casted), true
+	default:
+		return "", false
+	}
+}
+
+//sql returns the definition of the column in CREATE TABLE and ALTER TABLE statements
+func (def columnDefinition) sql() (string, error) {
+	if !isValidIdentifier(def.Name) {
+		return "", definitionError{fmt.Sprintf("invalid column name %q", def.Name)}
+	}
+	typ, ok := columnType(def.Type)
+	if !ok {
+		return "", definitionError{fmt.Sprintf("unsupported type %q of column %s", def.Type, def.Name)}
+	}
+	column := quoteIdentifier(def.Name) + " " + typ
+	if def.Nullable {
+		column += " NULL"
+	} else {
+		column += " NOT NULL"
+	}
+	if len(def.Default) > 0 {
+		literal, ok := defaultLiteral(def.Default)
+		if !ok {
+			return "", definitionError{"invalid default of column " + def.Name}
+		}
+		column += " DEFAULT " + literal
+	}
+	if def.AutoIncrement {
+		base := strings.Fields(typ)[0]
+		if open := strings.IndexByte(base, '('); open >= 0 {
+			base = base[:open]
+		}
+		if !strings.HasSuffix(base, "int") {
+			return "", definitionError{"auto_increment column " + def.Name + " must be an integer"}
+		}
+		column += " AUTO_INCREMENT"
+	}
+	return column, nil
+}
+
+//createTableSQL returns CREATE TABLE of the definition, primary key columns
+//form the primary key in their order
+func (def tableDefinition) createTableSQL() (string, error) {
+	if !isValidIdentifier(def.Name) {
+		return "", definitionError{fmt.Sprintf("invalid table name %q", def.Name)}
+	}
+	if len(def.Columns) == 0 {
+		return "", definitionError{"table " + def.Name + " has no columns"}
+	}
+	lines := make([]string, 0, len(def.Columns)+1)
+	var primaryKey []string
+	seen := make(map[string]bool, len(def.Columns))
+	for _, column := range def.Columns {
+		line, err := column.sql()
+		if err != nil {
+			return "", err
+		}
+		if seen[strings.ToLower(column.Name)] {
+			return "", definitionError{"duplicate column " + column.Name}
+		}
+		seen[strings.ToLower(column.Name)] = true
+		lines = append(lines, "  "+line)
+		if column.PrimaryKey {
+			primaryKey = append(primaryKey, quoteIdentifier(column.Name))
+		}
+	}
+	if len(primaryKey) > 0 {
+		lines = append(lines, "  PRIMARY KEY ("+strings.Join(primaryKey, ", ")+")")
+	}
+	return "CREATE TABLE " + quoteIdentifier(def.Name) + " (\n" + strings.Join(lines, ",\n") + "\n)", nil
+}
+
+//decodeDefinition decodes a JSON body of an admin request, unknown fields are rejected
+func decodeDefinition(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return definitionError{"can't parse a definition: " + err.Error()}
+	}
+	return nil
+}
+
+//execSchemaChange runs the DDL statement and reloads the schema,
+//false is returned if an error is served
+func execSchemaChange(w http.ResponseWriter, r *http.Request, l *Router, statement string) bool {
+	ctx, cancel := l.requestContext(r, RouteSchemaChange)
+	defer cancel()
+	_, err := l.db.ExecContext(ctx, statement)
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return false
+	}
+	err = l.Reload()
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+//serveChangedTable serves the JSON Schema of the table of the reloaded schema
+func serveChangedTable(w http.ResponseWriter, r *http.Request, l *Router, name string, status int) {
+	table, ok := l.snapshot().desc.tables[name]
+	if !ok {
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
+		log.Println("changed table is missing:", name)
+		return
+	}
+	serveRepresentation(w, contentTypeSchemaJSON, status, l.tableSchema(table))
+}
+
+//serveCreateTable creates a table by a definition like
+//{"name": "tags", "columns": [{"name": "id", "type": "int", "primary_key": true, "auto_increment": true}]}
+func serveCreateTable(w http.ResponseWriter, r *http.Request, l *Router) {
+	var def tableDefinition
+	err := decodeDefinition(r, &def)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+	statement, err := def.createTableSQL()
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+	if _, ok := l.desc.tables[def.Name]; ok {
+		RespError{HTTPStatus: http.StatusConflict, Error: "table already exists"}.serve(w, r, l)
+		return
+	}
+	if execSchemaChange(w, r, l, statement) {
+		serveChangedTable(w, r, l, def.Name, http.StatusCreated)
+	}
+}
+
+//serveDropTable drops the table
+func serveDropTable(w http.ResponseWriter, r *http.Request, l *Router, name string) {
+	table, ok := l.desc.tables[name]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	statement := "DROP TABLE "
+	if table.kind == "VIEW" {
+		statement = "DROP VIEW "
+	}
+	if execSchemaChange(w, r, l, statement+quoteIdentifier(name)) {
+		serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"deleted": 1}})
+	}
+}
+
+//serveAddColumn adds a column to the table by a definition like
+//{"name": "views", "type": "int", "default": 0}
+func serveAddColumn(w http.ResponseWriter, r *http.Request, l *Router, tableName string) {
+	table, ok := l.desc.tables[tableName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	if table.isReadOnly() {
+		table.serveReadOnly(w, r, l)
+		return
+	}
+	var def columnDefinition
+	err := decodeDefinition(r, &def)
+	if err == nil && (def.PrimaryKey || def.AutoIncrement) {
+		err = definitionError{"primary keys can't be added to existing tables"}
+	}
+	var column string
+	if err == nil {
+		column, err = def.sql()
+	}
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+	if _, ok = table.fields[def.Name]; ok {
+		RespError{HTTPStatus: http.StatusConflict, Error: "column already exists"}.serve(w, r, l)
+		return
+	}
+	if execSchemaChange(w, r, l, "ALTER TABLE "+quoteIdentifier(table.Name)+" ADD COLUMN "+column) {
+		serveChangedTable(w, r, l, table.Name, http.StatusOK)
+	}
+}
+
+//serveDropColumn drops the column of the table, the primary key can't be dropped
+func serveDropColumn(w http.ResponseWriter, r *http.Request, l *Router, tableName string, columnName string) {
+	table, ok := l.desc.tables[tableName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	if table.isReadOnly() {
+		table.serveReadOnly(w, r, l)
+		return
+	}
+	field, ok := table.fields[columnName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown column"}.serve(w, r, l)
+		return
+	}
+	if field.IsPrimaryKey {
+		RespError{HTTPStatus: http.StatusConflict, Error: "the primary key can't be dropped"}.serve(w, r, l)
+		return
+	}
+	if execSchemaChange(w, r, l, "ALTER TABLE "+quoteIdentifier(table.Name)+" DROP COLUMN "+quoteIdentifier(columnName)) {
+		serveChangedTable(w, r, l, table.Name, http.StatusOK)
+	}
+}
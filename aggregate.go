@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//aggregate is a selected column of grouped rows: a grouped column if function is empty
+//or a function of a column, * stands for all rows of count
+type aggregate struct {
+	function string
+	column   string
+	//alias replaces the name of the aggregate in result rows if it's set
+	alias string
+}
+
+//name returns a name of the aggregate in result rows, like max_id or count for count=*
+func (agg aggregate) name() string {
+	switch {
+	case agg.alias != "":
+		return agg.alias
+	case agg.function == "":
+		return agg.column
+	case agg.column == "*":
+		return agg.function
+	default:
+		return agg.function + "_" + agg.column
+	}
+}
+
+func (agg aggregate) expression() string {
+	switch {
+	case agg.function == "":
+		return quoteIdentifier(agg.column)
+	case agg.column == "*":
+		return "COUNT(*)"
+	default:
+		return strings.ToUpper(agg.function) + "(" + quoteIdentifier(agg.column) + ")"
+	}
+}
+
+//decode converts a raw value of the aggregate to a number or to the type of its column
+func (agg aggregate) decode(field FieldDesc, val sql.RawBytes) interface{} {
+	if val == nil {
+		return nil
+	}
+	switch agg.function {
+	case "count":
+		count, _ := strconv.Atoi(string(val))
+		return count
+	case "sum", "avg":
+		if intVal, err := strconv.Atoi(string(val)); err == nil {
+			return intVal
+		}
+		floatVal, _ := strconv.ParseFloat(string(val), 64)
+		return floatVal
+	default:
+		return field.decode(val)
+	}
+}
+
+//aggregateError is returned for aggregates not applicable to columns of the table
+type aggregateError struct {
+	message string
+}
+
+func (aggErr aggregateError) Error() string {
+	return aggErr.message
+}
+
+//listParam returns comma separated values of all occurrences of the parameter
+func listParam(query url.Values, key string) []string {
+	var values []string
+	for _, value := range query[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+//parseAggregates returns grouped columns and aggregates of the query,
+//sum and avg are allowed for numeric columns only, names of aggregates must be unique
+func parseAggregates(query url.Values, table TableDesc) ([]aggregate, error) {
+	var aggs []aggregate
+	for _, column := range listParam(query, "group_by") {
+		if _, ok := table.fields[column]; !ok {
+			return nil, aggregateError{"unknown column " + column}
+		}
+		aggs = append(aggs, aggregate{column: column})
+	}
+	groups := len(aggs)
+	//every function is a parameter listing columns, like ?count=*&max=id
+	for _, function := range []string{"count", "sum", "avg", "min", "max"} {
+		for _, column := range listParam(query, function) {
+			field, ok := table.fields[column]
+			switch {
+			case column == "*" && function == "count":
+			case !ok:
+				return nil, aggregateError{"unknown column " + column}
+			case (function == "sum" || function == "avg") && field.Type != "int" && !field.isFloat():
+				return nil, aggregateError{function + " of non-numeric column " + column}
+			}
+			aggs = append(aggs, aggregate{function: function, column: column})
+		}
+	}
+	if len(aggs) == groups {
+		return nil, aggregateError{"no aggregates"}
+	}
+	//results are keyed by names, group_by=count&count=* would have two count keys
+	names := make(map[string]bool, len(aggs))
+	for _, agg := range aggs {
+		if names[agg.name()] {
+			return nil, aggregateError{"duplicate name of aggregates " + agg.name()}
+		}
+		names[agg.name()] = true
+	}
+	return aggs, nil
+}
+
+//serveAggregate serves rows of the table grouped by group_by columns with aggregates
+//of every group, like GET /items/_aggregate?group_by=updated&count=*&max=id,
+//rows are filtered by filter and q like listed ones
+func serveAggregate(w http.ResponseWriter, r *http.Request, l *Router, tableName string) {
+	table, ok := l.desc.tables[tableName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	query := r.URL.Query()
+	aggs, err := parseAggregates(query, table)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+
+	q := newSelectQuery(table.Name)
+	_, err = filterRows(query, table, q)
+	if err != nil {
+		filterRespError(err).serve(w, r, l)
+		return
+	}
+	q.selectAggregates(aggs)
+	for _, agg := range aggs {
+		if agg.function == "" {
+			q.addOrder(agg.column, false)
+		}
+	}
+	q.limit = l.groupLimit(query)
+	q.offset, _ = strconv.Atoi(getIntValueAsStringFromQuery(query, "offset", "0"))
+
+	ctx, cancel := l.requestContext(r, RouteListRows)
+	defer cancel()
+	rows, err := queryAggregates(ctx, l.db, table, q, aggs)
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"records": rows}})
+}
+
+//groupLimit returns a limit of groups of rows: all groups are served unless limit is set,
+//but no more than maxLimit
+func (l *Router) groupLimit(query url.Values) int {
+	limit, _ := strconv.Atoi(getIntValueAsStringFromQuery(query, "limit", "-1"))
+	if l.maxLimit > 0 && (limit > l.maxLimit || limit < 0) {
+		limit = l.maxLimit
+	}
+	return limit
+}
+
+//selectAggregates sets columns of the query to the aggregates grouped by their grouped columns
+func (q *selectQuery) selectAggregates(aggs []aggregate) {
+	for _, agg := range aggs {
+		q.columns = append(q.columns, agg.expression())
+		if agg.function == "" {
+			q.groupBy = append(q.groupBy, agg.expression())
+		}
+	}
+}
+
+//queryAggregates runs the query of the aggregates and returns its rows keyed by names of them
+func queryAggregates(ctx context.Context, db queryer, table TableDesc, q *selectQuery, aggs []aggregate) ([]map[string]interface{}, error) {
+	sqlQuery, args := q.build()
+	res, err := db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+
+	vals := make([]interface{}, len(aggs))
+	for i := range vals {
+		vals[i] = new(sql.RawBytes)
+	}
+	rows := make([]map[string]interface{}, 0)
+	for res.Next() {
+		err = res.Scan(vals...)
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(aggs))
+		for i, agg := range aggs {
+			row[agg.name()] = agg.decode(table.fields[agg.column], *vals[i].(*sql.RawBytes))
+		}
+		rows = append(rows, row)
+	}
+	return rows, res.Err()
+}
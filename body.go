@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//maxMultipartMemory is a part of a multipart body which is kept in memory,
+//the rest of the files are stored in temporary files
+const maxMultipartMemory = 32 << 20
+
+const (
+	contentTypeJSON      = "application/json"
+	contentTypeForm      = "application/x-www-form-urlencoded"
+	contentTypeMultipart = "multipart/form-data"
+)
+
+//unsupportedContentTypeError is returned when a body can't be decoded
+//because of its Content-Type
+type unsupportedContentTypeError struct {
+	ContentType string
+}
+
+func (ctErr unsupportedContentTypeError) Error() string {
+	return "unsupported content type: " + ctErr.ContentType
+}
+
+//fieldTypeError represents a value which can't be converted to a type of the field
+type fieldTypeError struct {
+	Field string
+}
+
+func (fErr fieldTypeError) Error() string {
+	return "field " + fErr.Field + " have invalid type"
+}
+
+//decodeBody reads parameters of a request, the way of decoding is chosen by Content-Type.
+//Values of form-encoded and multipart bodies are converted to types of
+//the table fields, unknown fields are kept as strings
+func decodeBody(r *http.Request, tDesc TableDesc) (map[string]interface{}, error) {
+	mediaType := contentTypeJSON
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, unsupportedContentTypeError{contentType}
+		}
+	}
+
+	switch mediaType {
+	case contentTypeJSON:
+		params := make(map[string]interface{}, len(tDesc.fields))
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			return nil, err
+		}
+		return params, nil
+
+	case contentTypeForm:
+		err := r.ParseForm()
+		if err != nil {
+			return nil, err
+		}
+		return convertFormValues(tDesc, r.PostForm)
+
+	case contentTypeMultipart:
+		err := r.ParseMultipartForm(maxMultipartMemory)
+		if err != nil {
+			return nil, err
+		}
+		params, err := convertFormValues(tDesc, r.MultipartForm.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = readFileParts(tDesc, r.MultipartForm.File, params)
+		if err != nil {
+			return nil, err
+		}
+		return params, nil
+
+	default:
+		return nil, unsupportedContentTypeError{contentType}
+	}
+}
+
+//convertFormValues converts string values of a form to types of the table fields
+func convertFormValues(tDesc TableDesc, values map[string][]string) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(values))
+	for key, vals := range values {
+		if len(vals) == 0 {
+			continue
+		}
+		field, ok := tDesc.fields[key]
+		if !ok {
+			params[key] = vals[0]
+			continue
+		}
+		converted, err := field.parseFormValue(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		params[key] = converted
+	}
+	return params, nil
+}
+
+//readFileParts stores contents of files into BLOB fields of params,
+//file parts for other fields are ignored
+func readFileParts(tDesc TableDesc, files map[string][]*multipart.FileHeader, params map[string]interface{}) error {
+	for key, headers := range files {
+		field, ok := tDesc.fields[key]
+		if !ok || len(headers) == 0 || !field.isBlob() {
+			continue
+		}
+		file, err := headers[0].Open()
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(file)
+		closeErr := file.Close()
+		if err != nil {
+			return err
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+		params[key] = data
+	}
+	return nil
+}
+
+//isBlob reports whether the field stores binary data
+func (field FieldDesc) isBlob() bool {
+	return strings.Contains(field.Type, "blob") || strings.Contains(field.Type, "binary")
+}
+
+//isFloat reports whether the field stores floating point or decimal numbers
+func (field FieldDesc) isFloat() bool {
+	return strings.HasPrefix(field.Type, "float") ||
+		strings.HasPrefix(field.Type, "double") ||
+		strings.HasPrefix(field.Type, "decimal")
+}
+
+//validate checks that a decoded value fits the field,
+//nil is accepted for nullable fields only
+func (field FieldDesc) validate(v interface{}) error {
+	isValid := false
+	switch v.(type) {
+	case int:
+		isValid = field.Type == "int"
+	case float64:
+		isValid = field.Type == "int" || field.isFloat()
+	case string:
+		isValid = field.Type != "int"
+	case []byte:
+		isValid = field.isBlob()
+	case nil:
+		isValid = field.Nullable
+	}
+	if !isValid {
+		return fieldTypeError{field.Name}
+	}
+	return nil
+}
+
+//parseFormValue converts a string value of a form to the type of the field
+func (field FieldDesc) parseFormValue(value string) (interface{}, error) {
+	switch {
+	case field.Type == "int":
+		converted, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fieldTypeError{field.Name}
+		}
+		return converted, nil
+	case field.isFloat():
+		converted, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fieldTypeError{field.Name}
+		}
+		return converted, nil
+	case field.isBlob():
+		return []byte(value), nil
+	default:
+		return value, nil
+	}
+}
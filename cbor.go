@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+//Major types of CBOR data items
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborBytes    = 2 << 5
+	cborText     = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+	cborSimple   = 7 << 5
+)
+
+//encodeCBOR encodes v as CBOR (RFC 8949), integers of rows stay integers
+func encodeCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeCBOR(&buf, plainValue(v))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch casted := v.(type) {
+	case nil:
+		buf.WriteByte(cborSimple | 22)
+	case bool:
+		if casted {
+			buf.WriteByte(cborSimple | 21)
+		} else {
+			buf.WriteByte(cborSimple | 20)
+		}
+	case int64:
+		if casted >= 0 {
+			writeCBORHeader(buf, cborUnsigned, uint64(casted))
+		} else {
+			writeCBORHeader(buf, cborNegative, uint64(-1-casted))
+		}
+	case uint64:
+		writeCBORHeader(buf, cborUnsigned, casted)
+	case float64:
+		buf.WriteByte(cborSimple | 27)
+		writeBigEndian(buf, math.Float64bits(casted), 8)
+	case string:
+		writeCBORHeader(buf, cborText, uint64(len(casted)))
+		buf.WriteString(casted)
+	case []byte:
+		writeCBORHeader(buf, cborBytes, uint64(len(casted)))
+		buf.Write(casted)
+	case []interface{}:
+		writeCBORHeader(buf, cborArray, uint64(len(casted)))
+		for _, item := range casted {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case plainObject:
+		writeCBORHeader(buf, cborMap, uint64(len(casted)))
+		for _, field := range casted {
+			if err := writeCBOR(buf, field.Key); err != nil {
+				return err
+			}
+			if err := writeCBOR(buf, field.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+	return nil
+}
+
+//writeCBORHeader writes the major type with its argument in the shortest form
+func writeCBORHeader(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		writeBigEndian(buf, arg, 2)
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		writeBigEndian(buf, arg, 4)
+	default:
+		buf.WriteByte(major | 27)
+		writeBigEndian(buf, arg, 8)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+//commandsUsage describes commands which can be passed instead of starting the server
+const commandsUsage = `usage:
+  db_explorer                      start the server
+  db_explorer dump [table...]      write a SQL dump of all or the passed tables to stdout
+  db_explorer restore [file]       replay a SQL dump from the file or stdin in a transaction
+  db_explorer diff dsn             write statements making the schema of the database of dsn the same as this one
+  db_explorer migrate [-dir dir] up|down|status|to N
+                                   apply, revert or list migrations of the dir, migrations by default`
+
+//runCommand executes a command of the command line
+func runCommand(db *sql.DB, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(commandsUsage)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "dump":
+		desc, err := initExplorer(db)
+		if err != nil {
+			return err
+		}
+		tables, err := dumpTables(*desc, args[1:])
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		bw := bufio.NewWriter(stdout)
+		err = writeDump(ctx, tx, bw, *desc, tables)
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+
+	case "restore":
+		dump := stdin
+		if len(args) > 1 {
+			file, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			dump = file
+		}
+		executed, err := restoreDump(ctx, db, dump)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "%d statements executed\n", executed)
+		return err
+
+	case "diff":
+		if len(args) != 2 {
+			return errors.New(commandsUsage)
+		}
+		current, err := initExplorer(db)
+		if err != nil {
+			return err
+		}
+		otherDb, err := sql.Open("mysql", args[1])
+		if err != nil {
+			return err
+		}
+		defer otherDb.Close()
+		against, err := initExplorer(otherDb)
+		if err != nil {
+			return err
+		}
+		return writeDiff(stdout, diffSchemas(*current, *against))
+
+	case "migrate":
+		return runMigrateCommand(ctx, db, args[1:], stdout)
+
+	default:
+		return errors.New(commandsUsage)
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -12,6 +11,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,11 +31,59 @@ docker run -p 3306:3306 -v $(PWD):/docker-entrypoint-initdb.d -e MYSQL_ROOT_PASS
 
 type DbDesc struct {
 	tables map[string]TableDesc
+	//routines are stored procedures and functions called by POST /_rpc/$name
+	routines map[string]routineDesc
 }
 
+//tableKindBase is a kind of tables which aren't views, tables of other kinds are read-only
+const tableKindBase = "BASE TABLE"
+
 type TableDesc struct {
-	Name   string
+	Name string
+	//kind is a type of the table as SHOW FULL TABLES returns it, like BASE TABLE or VIEW
+	kind   string
 	fields map[string]FieldDesc
+	//foreignKeys are foreign keys of the table
+	foreignKeys []ForeignKey
+	//relations lead to rows of other tables by foreign keys of both the table and them
+	relations []relation
+	//indexes are secondary indexes of the table, the primary key isn't one of them
+	indexes []indexDesc
+	//fullTextIndexes are columns of FULLTEXT indexes of the table
+	fullTextIndexes [][]string
+}
+
+//isView reports whether the table is a view or another table which isn't a base one
+func (tDesc TableDesc) isView() bool {
+	return tDesc.kind != tableKindBase
+}
+
+//readOnlyKind returns a kind of the table if its rows can't be changed, like view,
+//rows of the table of applied migrations are changed by migrations only
+func (tDesc TableDesc) readOnlyKind() string {
+	if tDesc.isView() {
+		return strings.ToLower(tDesc.kind)
+	}
+	if tDesc.Name == migrationsTable {
+		return "migrations table"
+	}
+	return ""
+}
+
+//isReadOnly reports whether rows of the table can't be changed, like rows of a view
+func (tDesc TableDesc) isReadOnly() bool {
+	return tDesc.readOnlyKind() != ""
+}
+
+//serveReadOnly serves an answer to a request changing rows of a read-only table
+func (tDesc TableDesc) serveReadOnly(w http.ResponseWriter, r *http.Request, l *Router) {
+	w.Header().Set("Allow", http.MethodGet)
+	RespError{HTTPStatus: http.StatusMethodNotAllowed, Error: tDesc.readOnlyKind() + " is read-only"}.serve(w, r, l)
+}
+
+//serveNoPrimaryKey serves an answer to a request addressing a row by id in a table without a primary key
+func (tDesc TableDesc) serveNoPrimaryKey(w http.ResponseWriter, r *http.Request, l *Router) {
+	RespError{HTTPStatus: http.StatusNotFound, Error: "no primary key"}.serve(w, r, l)
 }
 
 func (tDesc TableDesc) getKeyField() *FieldDesc {
@@ -53,8 +102,14 @@ type FieldDesc struct {
 	IndexInTable int
 	Name         string
 	Type         string
+	//RawType is a type of the column as SHOW COLUMNS returns it, like varchar(255)
+	RawType      string
 	Nullable     bool
 	IsPrimaryKey bool
+	//Extra is the Extra column of SHOW COLUMNS, like auto_increment
+	Extra string
+	//Default is the Default column of SHOW COLUMNS, it isn't valid if the column has no default value
+	Default sql.NullString
 }
 
 func (field FieldDesc) getDefault() interface{} {
@@ -80,65 +135,96 @@ func (tDesc TableDesc) getFieldsArray() []FieldDesc {
 	return result
 }
 
-//RespError represents an error of API
-type RespError struct {
-	Error      string
-	HTTPStatus int
-}
-
-//PrepApiAnswer returns bytes for an answer with the error
-func (rErr RespError) PrepApiAnswer() []byte {
-	return []byte("{ \"error\":\"" + rErr.Error + "\"}")
-}
-
-//This function writes a RespError to a passed http.ResponseWriter
-func (rErr RespError) serve(w http.ResponseWriter) {
-	apiData := rErr.PrepApiAnswer()
-	w.Header().Set("Content-Type", http.DetectContentType(apiData))
-	w.WriteHeader(rErr.HTTPStatus)
-	_, err := w.Write(apiData)
-	if err != nil {
-		log.Println(err.Error())
-	}
-}
-
 type Tables struct {
 	Tables []string `json:"tables"`
+	//ReadOnly are kinds of read-only tables by their names, like view
+	ReadOnly map[string]string `json:"read_only,omitempty"`
 }
 
 type RespTables struct {
 	Response Tables `json:"response"`
 }
 
-func NewDbExplorer(db *sql.DB) (handler http.Handler, err error) {
+//Option configures a Router created by NewDbExplorer
+type Option func(*Router)
+
+//WithLegacyErrors chooses between the legacy {"error": ...} shape of errors
+//and application/problem+json answers
+func WithLegacyErrors(enabled bool) Option {
+	return func(l *Router) {
+		l.legacyErrors = enabled
+	}
+}
 
-	//Assume that a database doesn't change while this program works
-	//so description of a DB can be cashed in this case
+func NewDbExplorer(db *sql.DB, opts ...Option) (handler http.Handler, err error) {
+
+	//Description of a DB is cached, it's read again by Router.Reload
+	//if the schema changes
 	desc, err := initExplorer(db)
 	if err != nil {
 		return nil, err
 	}
 
 	m := http.NewServeMux()
-	handler = NewRouter(db, *desc)
+	router := NewRouter(db, *desc)
+	for _, opt := range opts {
+		opt(router)
+	}
+	for _, watch := range router.watchers {
+		go watch(router)
+	}
+	handler = router
 	m.Handle("/", handler)
 
 	return handler, nil
 }
 
 func initExplorer(db *sql.DB) (*DbDesc, error) {
-	knownTableNames, err := getTables(db)
+	knownTables, err := getTables(db)
 	if err != nil {
 		return nil, err
 	}
-	result := DbDesc{make(map[string]TableDesc)}
-	for _, tableName := range knownTableNames {
+	result := DbDesc{tables: make(map[string]TableDesc)}
+	for tableName, kind := range knownTables {
 		fields, err := getFields(db, tableName)
 		if err != nil {
 			return nil, err
 		}
-		result.tables[tableName] = TableDesc{tableName, fields}
+		result.tables[tableName] = TableDesc{Name: tableName, kind: kind, fields: fields}
+
+	}
+
+	foreignKeys, err := getForeignKeys(db)
+	if err != nil {
+		return nil, err
+	}
+	for tableName, keys := range foreignKeys {
+		if table, ok := result.tables[tableName]; ok {
+			table.foreignKeys = keys
+			result.tables[tableName] = table
+		}
+	}
+	linkRelations(result)
+
+	result.routines, err = getRoutines(db)
+	if err != nil {
+		return nil, err
+	}
 
+	indexes, err := getIndexes(db)
+	if err != nil {
+		return nil, err
+	}
+	for tableName, tableIndexes := range indexes {
+		if table, ok := result.tables[tableName]; ok {
+			table.indexes = tableIndexes
+			for _, index := range tableIndexes {
+				if index.kind == "FULLTEXT" {
+					table.fullTextIndexes = append(table.fullTextIndexes, index.columns)
+				}
+			}
+			result.tables[tableName] = table
+		}
 	}
 	return &result, nil
 }
@@ -180,6 +266,7 @@ func getFields(db *sql.DB, name string) (map[string]FieldDesc, error) {
 				fDesc.Name = string(*reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes))
 			case "Type":
 				typeRaw := string(*reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes))
+				fDesc.RawType = typeRaw
 				if strings.Contains(typeRaw, "int") {
 					fDesc.Type = "int"
 				} else {
@@ -189,6 +276,11 @@ func getFields(db *sql.DB, name string) (map[string]FieldDesc, error) {
 				fDesc.Nullable = string(*reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes)) == "YES"
 			case "Key":
 				fDesc.IsPrimaryKey = string(*reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes)) == "PRI"
+			case "Extra":
+				fDesc.Extra = string(*reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes))
+			case "Default":
+				defaultRaw := *reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes)
+				fDesc.Default = sql.NullString{String: string(defaultRaw), Valid: defaultRaw != nil}
 			}
 		}
 		fields[fDesc.Name] = fDesc
@@ -201,6 +293,34 @@ func getFields(db *sql.DB, name string) (map[string]FieldDesc, error) {
 type Router struct {
 	desc DbDesc
 	db   *sql.DB
+	//legacyErrors keeps the {"error": ...} shape of errors for clients
+	//which don't ask for application/problem+json
+	legacyErrors bool
+	//defaultTimeout limits database calls of routes missing in timeouts
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+	//maxLimit is a hard cap on the limit of listed rows, zero means no cap
+	maxLimit int
+	//exportNull represents NULL in text and spreadsheet exports
+	exportNull string
+	//encoders of answers chosen by the Accept header, the first one is the default
+	encoders []ResponseEncoder
+	//basePath prefixes links of JSON:API and HAL representations
+	basePath string
+	//graphql is a schema of /graphql generated from desc
+	graphql *gqlSchema
+	//schema holds the current *schemaSnapshot, desc and graphql are set from it
+	//for every request so the request is served by one snapshot
+	schema   *atomic.Value
+	reloadMu *sync.Mutex
+	//watchers reload the schema on events, they are started by NewDbExplorer
+	watchers []func(l *Router)
+	//adminToken is a bearer token of admin endpoints
+	adminToken string
+	//diffTargets are databases the schema can be compared with by their names
+	diffTargets map[string]*sql.DB
+	//migrationsDir is a directory of migrations run by admin endpoints
+	migrationsDir string
 }
 
 //ServeHTTP handles the request by passing it to the real
@@ -208,6 +328,11 @@ type Router struct {
 func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	snapshot := l.snapshot()
+	requestRouter := *l
+	requestRouter.desc, requestRouter.graphql = snapshot.desc, snapshot.graphql
+	l = &requestRouter
+
 	switch r.Method {
 
 	case http.MethodGet:
@@ -223,8 +348,8 @@ func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		serveDelete(w, r, l)
 
 	default:
-		//we have to send http.StatusInternalServerError when any error occurs instead of http.StatusMethodNotAllowed
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Method not allowed"}.serve(w)
+		w.Header().Set("Allow", allowedMethods)
+		RespError{HTTPStatus: http.StatusMethodNotAllowed, Error: "Method not allowed"}.serve(w, r, l)
 
 	}
 
@@ -237,7 +362,7 @@ func servePut(w http.ResponseWriter, r *http.Request, l *Router) {
 
 	pathSegments := strings.Split(r.URL.Path, "/")
 	if len(pathSegments) < 2 {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
 		return
 	}
 	searchTable := pathSegments[1]
@@ -245,18 +370,20 @@ func servePut(w http.ResponseWriter, r *http.Request, l *Router) {
 	var ok bool
 	var foundTable TableDesc
 	if foundTable, ok = l.desc.tables[searchTable]; !ok {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
 		return
 	}
 
 	fmt.Println("foundTable", foundTable)
+	if foundTable.isReadOnly() {
+		foundTable.serveReadOnly(w, r, l)
+		return
+	}
 
 	//read
-	decoder := json.NewDecoder(r.Body)
-	requestedParams := make(map[string]interface{}, len(foundTable.fields))
-	err := decoder.Decode(&requestedParams)
+	requestedParams, err := decodeBody(r, foundTable)
 	if err != nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		bodyError(err).serve(w, r, l)
 		return
 	}
 	defer func() {
@@ -266,36 +393,22 @@ func servePut(w http.ResponseWriter, r *http.Request, l *Router) {
 		}
 	}()
 	log.Println("requestedParams", requestedParams)
-	fields := foundTable.getFieldsArray()
 	sqlQuery := foundTable.prepInsertSqlQuery()
 	log.Println("prepared sql query:", sqlQuery)
 
-	result := make([]interface{}, len(fields))
 	keyField := foundTable.getKeyField()
 	if keyField == nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
 		log.Println("keyField == nil")
 		return
 	}
-	var idx = -1
-	for _, field := range fields {
-		idx++
-		//assume that a Primary Key always has auto increment
-		//so we don't use a got value for this field
-		if field.IsPrimaryKey {
-			result[idx] = field.getDefault()
-			continue
-		}
-		if found, ok := requestedParams[field.Name]; !ok || found == nil {
-			result[idx] = field.getDefault()
-		} else {
-			result[idx] = found
-		}
-	}
+	result := foundTable.prepInsertValues(requestedParams)
 
-	res, err := l.db.Exec(sqlQuery, result...)
+	ctx, cancel := l.requestContext(r, RouteCreateRow)
+	defer cancel()
+	res, err := l.db.ExecContext(ctx, sqlQuery, result...)
 	if err != nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		dbError(err).serve(w, r, l)
 		log.Println("db.Exec with err:", err, " passed values:", result)
 		return
 	}
@@ -303,18 +416,61 @@ func servePut(w http.ResponseWriter, r *http.Request, l *Router) {
 	id, err := res.LastInsertId()
 	if err != nil {
 		log.Println("LastInsertId err:", err)
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
 		return
 	}
-	serveAnswer(w, map[string]interface{}{"response": map[string]interface{}{keyField.Name: id}})
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{keyField.Name: id}})
 }
 
-func prepareUpdateQuery(tableName string, keyFieldName string, params map[string]interface{}) string {
-	values := make([]string, 0)
-	for k := range params {
+//updateFields validates params of an update of a row and returns names of the known
+//fields in a single order for both the query and its parameters, unknown fields are ignored
+func (tDesc TableDesc) updateFields(params map[string]interface{}) ([]string, error) {
+	keyField := tDesc.getKeyField()
+	fieldNames := make([]string, 0, len(params))
+	for k, v := range params {
+		if keyField != nil && k == keyField.Name { // id is not allowed to change
+			return nil, fieldTypeError{keyField.Name}
+		}
+
+		if foundField, ok := tDesc.fields[k]; ok {
+			if err := foundField.validate(v); err != nil {
+				return nil, err
+			}
+			fieldNames = append(fieldNames, k)
+		}
+	}
+	sort.Strings(fieldNames)
+	return fieldNames, nil
+}
+
+//prepareUpdateQuery returns a query updating the passed fields in their order
+func prepareUpdateQuery(tableName string, keyFieldName string, fieldNames []string) string {
+	values := make([]string, 0, len(fieldNames))
+	for _, k := range fieldNames {
 		values = append(values, fmt.Sprintf("%s = ?", k))
 	}
-	return fmt.Sprintf("update %s set %s where %s = ?", tableName, strings.Join(values, ","),keyFieldName)
+	return fmt.Sprintf("update %s set %s where %s = ?", tableName, strings.Join(values, ","), keyFieldName)
+}
+
+//prepInsertValues returns values of all fields for prepInsertSqlQuery,
+//missing and null params are replaced by defaults of the fields
+func (tDesc TableDesc) prepInsertValues(params map[string]interface{}) []interface{} {
+	fields := tDesc.getFieldsArray()
+	result := make([]interface{}, len(fields))
+	for idx, field := range fields {
+		//assume that a Primary Key always has auto increment
+		//so we don't use a got value for this field
+		if field.IsPrimaryKey {
+			result[idx] = field.getDefault()
+			continue
+		}
+		if found, ok := params[field.Name]; !ok || found == nil {
+			result[idx] = field.getDefault()
+		} else {
+			result[idx] = found
+		}
+	}
+	return result
 }
 
 func (tDesc TableDesc) prepInsertSqlQuery() string {
@@ -335,10 +491,15 @@ func (tDesc TableDesc) prepInsertSqlQuery() string {
 func serveDelete(w http.ResponseWriter, r *http.Request, l *Router) {
 	log.Printf("serveDelete %s %s", r.Method, r.URL.Path)
 
+	if strings.HasPrefix(r.URL.Path, "/_admin/") {
+		serveAdmin(w, r, l)
+		return
+	}
+
 	pathSegments := strings.Split(r.URL.Path, "/")
 
 	if len(pathSegments) != 3 {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w, r, l)
 		return
 	}
 
@@ -347,41 +508,76 @@ func serveDelete(w http.ResponseWriter, r *http.Request, l *Router) {
 	var ok bool
 	var foundTable TableDesc
 	if foundTable, ok = l.desc.tables[searchTable]; !ok {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	if foundTable.isReadOnly() {
+		foundTable.serveReadOnly(w, r, l)
 		return
 	}
 
 	id, err := strconv.Atoi(pathSegments[2])
 	if err != nil {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown id"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown id"}.serve(w, r, l)
 		return
 	}
 
-	sqlQuery := fmt.Sprintf("delete from %s where id = ?", foundTable.Name)
+	keyField := foundTable.getKeyField()
+	if keyField == nil {
+		foundTable.serveNoPrimaryKey(w, r, l)
+		return
+	}
+
+	sqlQuery := fmt.Sprintf("delete from %s where %s = ?", foundTable.Name, keyField.Name)
 	log.Println("sql query:", sqlQuery)
-	res, err := l.db.Exec(sqlQuery, id)
+	ctx, cancel := l.requestContext(r, RouteDeleteRow)
+	defer cancel()
+	res, err := l.db.ExecContext(ctx, sqlQuery, id)
 	if err != nil {
 		log.Println("err db.Exec:", err)
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		dbError(err).serve(w, r, l)
 		return
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
 		return
 	}
-	serveAnswer(w, map[string]interface{}{"response": map[string]interface{}{"deleted": rowsAffected}})
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"deleted": rowsAffected}})
 }
 
 //servePost serves for http.MethodPost requests
 func servePost(w http.ResponseWriter, r *http.Request, l *Router) {
 	log.Printf("servePost %s %s", r.Method, r.URL.Path)
 
+	if r.URL.Path == "/_dump" {
+		//a dump replays any SQL, so it's an admin endpoint
+		if l.authorizeAdmin(w, r) {
+			serveRestore(w, r, l)
+		}
+		return
+	}
+
+	if r.URL.Path == "/graphql" {
+		serveGraphQL(w, r, l)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/_admin/") {
+		serveAdmin(w, r, l)
+		return
+	}
+
 	pathSegments := strings.Split(r.URL.Path, "/")
 
 	if len(pathSegments) != 3 {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w, r, l)
+		return
+	}
+
+	if pathSegments[1] == "_rpc" {
+		serveRPC(w, r, l, pathSegments[2])
 		return
 	}
 
@@ -390,98 +586,68 @@ func servePost(w http.ResponseWriter, r *http.Request, l *Router) {
 	var ok bool
 	var foundTable TableDesc
 	if foundTable, ok = l.desc.tables[searchTable]; !ok {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	if foundTable.isReadOnly() {
+		foundTable.serveReadOnly(w, r, l)
+		return
+	}
+
+	if pathSegments[2] == "_import" {
+		serveImport(w, r, l, foundTable)
 		return
 	}
 
 	id, err := strconv.Atoi(pathSegments[2])
 	if err != nil {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown id"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown id"}.serve(w, r, l)
 		return
 	}
 
-	fields := foundTable.getFieldsArray()
-	fieldsLen := len(fields)
-
-	decoder := json.NewDecoder(r.Body)
-	requestParams := make(map[string]interface{}, fieldsLen)
-	err = decoder.Decode(&requestParams)
+	requestParams, err := decodeBody(r, foundTable)
 	if err != nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "can't parse a body"}.serve(w)
+		bodyError(err).serve(w, r, l)
 		return
 	}
 	log.Println("requestParams: ", requestParams)
 	keyField := foundTable.getKeyField()
 	if keyField == nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
-		log.Println("keyField == nil")
+		foundTable.serveNoPrimaryKey(w, r, l)
 		return
 	}
 
-
-	for k, v := range requestParams {
-		log.Println("requestParams: k:", k, "v:", v)
-		if k == keyField.Name { // id is not allowed to change
-			RespError{HTTPStatus: http.StatusBadRequest, Error: fmt.Sprintf("field %s have invalid type", keyField.Name)}.serve(w)
-			return
-		}
-
-		if foundField, ok := foundTable.fields[k]; ok {
-
-			fmt.Println(foundField)
-			var isInvalidType = false
-			switch casted := v.(type) {
-			case int:
-				if foundField.Type != "int" {
-					isInvalidType = true
-				}
-			case float64:
-				if foundField.Type != "int" {
-					isInvalidType = true
-				}
-			case string:
-				if foundField.Type == "int" {
-					isInvalidType = true
-				}
-			default:
-				if !foundField.Nullable {
-					log.Println(casted)
-					isInvalidType = true
-				} else {
-					requestParams[k] = sql.NullString{}
-				}
-			}
-			if isInvalidType {
-				RespError{HTTPStatus: http.StatusBadRequest, Error: "field " + foundField.Name + " have invalid type"}.serve(w)
-				return
-			}
-		}
+	fieldNames, err := foundTable.updateFields(requestParams)
+	if err != nil {
+		bodyError(err).serve(w, r, l)
+		return
 	}
 
-
-	sqlQ := prepareUpdateQuery(foundTable.Name, keyField.Name, requestParams)
+	sqlQ := prepareUpdateQuery(foundTable.Name, keyField.Name, fieldNames)
 	log.Println("sql query:", sqlQ)
 
-	preparedParams := make([]interface{}, 0)
-	for _, v := range requestParams {
-		preparedParams = append(preparedParams, v)
+	preparedParams := make([]interface{}, 0, len(fieldNames)+1)
+	for _, k := range fieldNames {
+		preparedParams = append(preparedParams, requestParams[k])
 	}
 	preparedParams = append(preparedParams, id)
 
-	res, err := l.db.Exec(sqlQ, preparedParams...)
+	ctx, cancel := l.requestContext(r, RouteUpdateRow)
+	defer cancel()
+	res, err := l.db.ExecContext(ctx, sqlQ, preparedParams...)
 	if err != nil {
 		log.Println("err db.Exec:", err)
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		dbError(err).serve(w, r, l)
 		return
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
 		return
 	}
 
-	serveAnswer(w, map[string]interface{}{"response": map[string]interface{}{"updated": rowsAffected}})
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"updated": rowsAffected}})
 }
 
 //serveGet serves for http.MethodGet requests
@@ -489,7 +655,30 @@ func serveGet(w http.ResponseWriter, r *http.Request, l *Router) {
 	log.Printf("serveGet %s %s", r.Method, r.URL.Path)
 
 	if r.URL.Path == "/" {
-		serveListTables(w, l.desc)
+		serveListTables(w, r, l)
+		return
+	}
+
+	if r.URL.Path == "/_dump" {
+		//a dump has all rows of tables, so it's an admin endpoint
+		if l.authorizeAdmin(w, r) {
+			serveDump(w, r, l)
+		}
+		return
+	}
+
+	if r.URL.Path == "/_openapi.json" {
+		serveOpenAPI(w, r, l)
+		return
+	}
+
+	if r.URL.Path == "/graphql" {
+		serveGraphQL(w, r, l)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/_admin/") {
+		serveAdmin(w, r, l)
 		return
 	}
 
@@ -497,30 +686,51 @@ func serveGet(w http.ResponseWriter, r *http.Request, l *Router) {
 	log.Printf("pathSegments %d %s", len(pathSegments), pathSegments)
 	switch len(pathSegments) {
 	case 1:
-		serveListRows(l.db, w, l.desc, pathSegments[0], r.URL.Query())
+		serveListRows(w, r, l, pathSegments[0])
 
 	case 2:
-		serveRowById(l.db, w, l.desc, pathSegments[0], pathSegments[1])
+		if pathSegments[1] == "_schema" {
+			serveTableSchema(w, r, l, pathSegments[0])
+			return
+		}
+		if pathSegments[1] == "_aggregate" {
+			serveAggregate(w, r, l, pathSegments[0])
+			return
+		}
+		serveRowById(w, r, l, pathSegments[0], pathSegments[1])
+
+	case 3:
+		if pathSegments[1] == "_distinct" {
+			serveDistinct(w, r, l, pathSegments[0], pathSegments[2])
+			return
+		}
+		serveRelated(w, r, l, pathSegments[0], pathSegments[1], pathSegments[2])
 
 	default:
-		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "Not Found"}.serve(w, r, l)
 
 	}
 
 }
 
-func serveRowById(db *sql.DB, w http.ResponseWriter, desc DbDesc, tableName string, id string) {
-	if foundTable, ok := desc.tables[tableName]; ok {
+func serveRowById(w http.ResponseWriter, r *http.Request, l *Router, tableName string, id string) {
+	if foundTable, ok := l.desc.tables[tableName]; ok {
 		keyField := foundTable.getKeyField()
 		if keyField == nil {
-			RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
-			log.Println("keyField == nil")
+			foundTable.serveNoPrimaryKey(w, r, l)
+			return
+		}
+		rels, err := parseExpand(r, foundTable)
+		if err != nil {
+			RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
 			return
 		}
 		sqlQ := fmt.Sprintf("SELECT * FROM %s WHERE %s = ?", tableName, keyField.Name)
-		res, err := db.Query(sqlQ, id)
+		ctx, cancel := l.requestContext(r, RouteGetRow)
+		defer cancel()
+		res, err := l.db.QueryContext(ctx, sqlQ, id)
 		if err != nil {
-			RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+			dbError(err).serve(w, r, l)
 			log.Println(err)
 			return
 		}
@@ -531,128 +741,192 @@ func serveRowById(db *sql.DB, w http.ResponseWriter, desc DbDesc, tableName stri
 			}
 		}()
 
-		cols, err := res.Columns()
+		codec, err := newRowCodec(foundTable, res)
 		if err != nil {
-			RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+			RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
 			log.Println(err)
 			return
 		}
-		vals := make([]interface{}, len(cols))
-		for i, _ := range cols {
-			vals[i] = new(sql.RawBytes)
-		}
 
 		rows := make([]interface{}, 0)
 		for res.Next() {
-			err = res.Scan(vals...)
+			row, err := codec.scan(res)
 			if err != nil {
-				RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+				dbError(err).serve(w, r, l)
 				log.Println(err)
 				return
 			}
-			row := make(map[string]interface{})
-
-			for i, col := range cols {
-				var val = *reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes)
-				if val != nil {
-					var field FieldDesc
-					if descField, ok := foundTable.fields[col]; ok {
-						field = descField
-					}
-					if field.Type == "int" {
-						r, _ := strconv.Atoi(string(val))
-						row[col] = r
-					} else {
-						row[col] = string(val)
-					}
-
-				} else {
-
-					row[col] = nil
-				}
-			}
-
 			rows = append(rows, row)
 		}
+		if err = res.Err(); err != nil {
+			dbError(err).serve(w, r, l)
+			log.Println(err)
+			return
+		}
 		if len(rows) == 1 {
-			serveAnswer(w, map[string]interface{}{"response": map[string]interface{}{"record": rows[0]}})
+			if len(rels) > 0 {
+				err = expandRows(ctx, l.db, l.desc, rels, []map[string]interface{}{rows[0].(map[string]interface{})}, l.maxLimit)
+				if err != nil {
+					dbError(err).serve(w, r, l)
+					log.Println(err)
+					return
+				}
+			}
+			if representation := l.representation(r); representation != "" {
+				serveRowResource(w, r, l, representation, foundTable, rows[0].(map[string]interface{}))
+				return
+			}
+			serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"record": rows[0]}})
 		} else {
-			RespError{HTTPStatus: http.StatusNotFound, Error: "record not found"}.serve(w)
+			RespError{HTTPStatus: http.StatusNotFound, Error: "record not found"}.serve(w, r, l)
 		}
 
 	} else {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w)
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
 	}
 }
 
-func serveListRows(db *sql.DB, w http.ResponseWriter, desc DbDesc, tableName string, query url.Values) {
-	if found, ok := desc.tables[tableName]; ok {
+//serveListRows streams rows of the table in the negotiated format,
+//they aren't accumulated in memory
+func serveListRows(w http.ResponseWriter, r *http.Request, l *Router, tableName string) {
+	if found, ok := l.desc.tables[tableName]; ok {
 		log.Println("found description:", found)
-		limitStr := getIntValueAsStringFromQuery(query, "limit", "5")
+		serveRows(w, r, l, found, newSelectQuery(found.Name), RouteListRows)
+	} else {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+	}
+}
+
+//serveRows streams rows of the table chosen by the query, a page of them
+//is set by limit and offset parameters of the request
+func serveRows(w http.ResponseWriter, r *http.Request, l *Router, table TableDesc, q *selectQuery, route string) {
+	query := r.URL.Query()
+	limitStr := getIntValueAsStringFromQuery(query, "limit", strconv.Itoa(defaultLimit))
+	if limit, _ := strconv.Atoi(limitStr); l.maxLimit > 0 && (limit > l.maxLimit || limit < 0) {
+		limitStr = strconv.Itoa(l.maxLimit)
+	}
 
-		offsetStr := getIntValueAsStringFromQuery(query, "offset", "0")
+	offsetStr := getIntValueAsStringFromQuery(query, "offset", "0")
 
-		res2, err := db.Query("select * from " + tableName + " limit " + limitStr + " offset " + offsetStr)
+	q.limit, _ = strconv.Atoi(limitStr)
+	q.offset, _ = strconv.Atoi(offsetStr)
+	rels, err := parseExpand(r, table)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+	search, err := filterRows(query, table, q)
+	if err != nil {
+		filterRespError(err).serve(w, r, l)
+		return
+	}
+	facetColumns, err := parseFacets(query, table)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+	sample, err := parseSampling(query)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}.serve(w, r, l)
+		return
+	}
+	filtered := q.filtered()
+	if search != nil {
+		search.rank(q)
+		if keyField := table.getKeyField(); keyField != nil {
+			q.addOrder(keyField.Name, false)
+		}
+	}
+	enc, ok := newRowEncoder(w, r, l, table, q.limit, q.offset)
+	if !ok {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: "unknown format"}.serve(w, r, l)
+		return
+	}
+
+	ctx, cancel := l.requestContext(r, route)
+	defer cancel()
+	if len(facetColumns) > 0 {
+		facets, err := l.queryFacets(ctx, query, table, filtered, facetColumns)
 		if err != nil {
-			RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+			dbError(err).serve(w, r, l)
 			log.Println(err)
 			return
 		}
-
-		defer func() {
-			err = res2.Close()
-			if err != nil {
-				log.Println("error while closing rows:", err)
-			}
-		}()
-
-		cols, err := res2.Columns()
+		if fEnc, ok := enc.(facetEncoder); !ok || !fEnc.setFacets(facets) {
+			RespError{HTTPStatus: http.StatusBadRequest, Error: "facets aren't supported by the format"}.serve(w, r, l)
+			return
+		}
+	}
+	if sample != nil {
+		err = sample.apply(ctx, l.db, table, q, l.maxLimit)
 		if err != nil {
-			RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+			dbError(err).serve(w, r, l)
 			log.Println(err)
 			return
 		}
-		vals := make([]interface{}, len(cols))
-		for i, _ := range cols {
-			vals[i] = new(sql.RawBytes)
-		}
+	}
+	sqlQuery, args := q.build()
+	res2, err := l.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return
+	}
 
-		rows := make([]interface{}, 0)
-		for res2.Next() {
-			err = res2.Scan(vals...)
-			if err != nil {
-				RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
-				log.Println(err)
-				return
-			}
-			row := make(map[string]interface{})
-
-			for i, col := range cols {
-				var val = *reflect.ValueOf(vals[i]).Interface().(*sql.RawBytes)
-				if val != nil {
-					var field FieldDesc
-					if descField, ok := found.fields[col]; ok {
-						field = descField
-					}
-					if field.Type == "int" {
-						r, _ := strconv.Atoi(string(val))
-						row[col] = r
-					} else {
-						row[col] = string(val)
-					}
+	defer func() {
+		err = res2.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
 
-				} else {
+	codec, err := newRowCodec(table, res2)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
+		log.Println(err)
+		return
+	}
 
-					row[col] = nil
-				}
+	//expanded rows are read first to look related ones up by a query per relation
+	var expanded []map[string]interface{}
+	for res2.Next() {
+		row, err := codec.scan(res2)
+		if err == nil {
+			if search != nil {
+				search.decorate(row)
+			}
+			if len(rels) > 0 {
+				expanded = append(expanded, row)
+				continue
+			}
+			err = enc.writeRow(row)
+		}
+		if err != nil {
+			failStream(w, r, l, enc, err)
+			return
+		}
+	}
+	if err = res2.Err(); err != nil {
+		failStream(w, r, l, enc, err)
+		return
+	}
+	if len(rels) > 0 {
+		err = expandRows(ctx, l.db, l.desc, rels, expanded, l.maxLimit)
+		if err != nil {
+			dbError(err).serve(w, r, l)
+			log.Println(err)
+			return
+		}
+		for _, row := range expanded {
+			if err = enc.writeRow(row); err != nil {
+				failStream(w, r, l, enc, err)
+				return
 			}
-
-			rows = append(rows, row)
 		}
-
-		serveAnswer(w, map[string]interface{}{"response": map[string]interface{}{"records": rows}})
-	} else {
-		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w)
+	}
+	err = enc.finish()
+	if err != nil {
+		log.Println("can't serve:" + err.Error())
 	}
 }
 
@@ -669,25 +943,38 @@ func getIntValueAsStringFromQuery(query url.Values, key string, defaultValue str
 	return result
 }
 
-func serveListTables(w http.ResponseWriter, desc DbDesc) {
+func serveListTables(w http.ResponseWriter, r *http.Request, l *Router) {
+	serveAnswer(w, r, l, newRespTables(l.desc))
+}
+
+//newRespTables returns names of tables of the description with kinds of read-only ones
+func newRespTables(desc DbDesc) RespTables {
 	resp := RespTables{}
-	for key, _ := range desc.tables {
+	for key, table := range desc.tables {
 		resp.Response.Tables = append(resp.Response.Tables, key)
+		if table.isReadOnly() {
+			if resp.Response.ReadOnly == nil {
+				resp.Response.ReadOnly = make(map[string]string)
+			}
+			resp.Response.ReadOnly[key] = table.readOnlyKind()
+		}
 	}
 	sort.Slice(resp.Response.Tables, func(i, j int) bool {
 		return resp.Response.Tables[i] < resp.Response.Tables[j]
 	})
-	serveAnswer(w, resp)
+	return resp
 }
 
-func serveAnswer(w http.ResponseWriter, v interface{}) {
-	data, err := json.Marshal(v)
+//serveAnswer writes v by the encoder negotiated with the client
+func serveAnswer(w http.ResponseWriter, r *http.Request, l *Router, v interface{}) {
+	enc, _ := l.negotiateEncoder(r)
+	data, err := enc.Encode(v)
 	if err != nil {
-		log.Printf("can't json.Marshal by err [%s] with:\n %+v\n", err.Error(), v)
-		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w)
+		log.Printf("can't encode %s by err [%s] with:\n %+v\n", enc.MediaType, err.Error(), v)
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
 		return
 	}
-	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Type", enc.MediaType)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(data)
 	if err != nil {
@@ -697,16 +984,29 @@ func serveAnswer(w http.ResponseWriter, v interface{}) {
 
 //NewRouter constructs a new Router middleware handler
 func NewRouter(db *sql.DB, desc DbDesc) *Router {
-	return &Router{desc, db}
+	snapshot := newSchemaSnapshot(desc, "")
+	schema := &atomic.Value{}
+	schema.Store(snapshot)
+	return &Router{
+		desc:         desc,
+		db:           db,
+		legacyErrors: true,
+		maxLimit:     defaultMaxLimit,
+		encoders:     defaultEncoders(),
+		graphql:      snapshot.graphql,
+		schema:       schema,
+		reloadMu:     &sync.Mutex{},
+	}
 }
 
-//getTables returns a list of tables or error
-func getTables(db *sql.DB) (tables []string, err error) {
+//getTables returns kinds of tables of the current database by their names,
+//like BASE TABLE or VIEW
+func getTables(db *sql.DB) (tables map[string]string, err error) {
 	if db == nil {
 		return nil, errors.New("*sql.Db is <nil>")
 	}
 	var res *sql.Rows
-	res, err = db.Query("SHOW TABLES")
+	res, err = db.Query("SHOW FULL TABLES")
 	if err != nil {
 		return nil, err
 	}
@@ -716,14 +1016,15 @@ func getTables(db *sql.DB) (tables []string, err error) {
 			log.Println("error while closing rows:", err)
 		}
 	}()
-	var table string
+	var table, kind string
 
+	tables = make(map[string]string)
 	for res.Next() {
-		err = res.Scan(&table)
+		err = res.Scan(&table, &kind)
 		if err != nil {
 			return nil, err
 		}
-		tables = append(tables, table)
+		tables[table] = kind
 	}
 	return
 }
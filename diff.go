@@ -0,0 +1,341 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//indexDesc is a secondary index of a table
+type indexDesc struct {
+	name   string
+	unique bool
+	//kind is INDEX_TYPE of information_schema.STATISTICS, like BTREE or FULLTEXT
+	kind    string
+	columns []string
+}
+
+//getIndexes returns secondary indexes of tables of the current database by names of the tables
+func getIndexes(db *sql.DB) (map[string][]indexDesc, error) {
+	res, err := db.Query(`SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME, INDEX_TYPE
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE() AND INDEX_NAME <> 'PRIMARY'
+ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+
+	indexes := make(map[string][]indexDesc)
+	lastTable, lastIndex := "", ""
+	for res.Next() {
+		var table, name, column, kind string
+		var nonUnique int
+		err = res.Scan(&table, &name, &nonUnique, &column, &kind)
+		if err != nil {
+			return nil, err
+		}
+		tableIndexes := indexes[table]
+		if lastTable != table || lastIndex != name {
+			tableIndexes = append(tableIndexes, indexDesc{name: name, unique: nonUnique == 0, kind: kind})
+		}
+		last := &tableIndexes[len(tableIndexes)-1]
+		last.columns = append(last.columns, column)
+		indexes[table] = tableIndexes
+		lastTable, lastIndex = table, name
+	}
+	return indexes, res.Err()
+}
+
+//WithDiffTarget names a database the schema can be compared with
+//by GET /_admin/diff?against=name
+func WithDiffTarget(name string, db *sql.DB) Option {
+	return func(l *Router) {
+		if l.diffTargets == nil {
+			l.diffTargets = make(map[string]*sql.DB)
+		}
+		l.diffTargets[name] = db
+	}
+}
+
+//schemaChange is a difference of two schemas with a statement removing it
+type schemaChange struct {
+	Table       string `json:"table"`
+	Description string `json:"description"`
+	Statement   string `json:"statement"`
+}
+
+//diffSchemas compares tables, columns, their types and nullability, primary keys,
+//indexes and foreign keys of two databases. Statements of the changes applied
+//to the against database in their order make its schema the same as the current one.
+//Defaults of columns and views aren't compared
+func diffSchemas(current DbDesc, against DbDesc) []schemaChange {
+	changes := make([]schemaChange, 0)
+	var addedKeys []schemaChange
+
+	for _, name := range sortedTableNames(current, against) {
+		table, inCurrent := current.tables[name]
+		other, inAgainst := against.tables[name]
+		if (inCurrent && table.isView()) || (inAgainst && other.isView()) {
+			continue
+		}
+		switch {
+		case !inAgainst:
+			changes = append(changes, schemaChange{name, "create table " + name, createTableStatement(table)})
+			for _, fk := range table.foreignKeys {
+				addedKeys = append(addedKeys, addForeignKeyChange(table, fk))
+			}
+		case !inCurrent:
+			changes = append(changes, schemaChange{name, "drop table " + name, "DROP TABLE " + quoteIdentifier(name) + ";"})
+		default:
+			tableChanges, tableKeys := diffTables(table, other)
+			changes = append(changes, tableChanges...)
+			addedKeys = append(addedKeys, tableKeys...)
+		}
+	}
+	//foreign keys are added last so tables and indexes they need exist
+	return append(changes, addedKeys...)
+}
+
+//sortedTableNames returns names of tables of both schemas in ascending order
+func sortedTableNames(current DbDesc, against DbDesc) []string {
+	var names []string
+	for name := range current.tables {
+		names = append(names, name)
+	}
+	for name := range against.tables {
+		if _, ok := current.tables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//diffTables returns changes of a table present in both schemas,
+//foreign keys to add are returned separately
+func diffTables(table TableDesc, other TableDesc) ([]schemaChange, []schemaChange) {
+	var changes, addedKeys []schemaChange
+	alter := "ALTER TABLE " + quoteIdentifier(table.Name) + " "
+
+	foreignKeys := make(map[string]ForeignKey, len(other.foreignKeys))
+	for _, fk := range other.foreignKeys {
+		foreignKeys[fk.Name] = fk
+	}
+	for _, fk := range table.foreignKeys {
+		otherFk, ok := foreignKeys[fk.Name]
+		if ok && reflect.DeepEqual(fk, otherFk) {
+			delete(foreignKeys, fk.Name)
+			continue
+		}
+		addedKeys = append(addedKeys, addForeignKeyChange(table, fk))
+	}
+	for _, fk := range other.foreignKeys {
+		if _, ok := foreignKeys[fk.Name]; ok {
+			changes = append(changes, schemaChange{table.Name, "drop foreign key " + fk.Name + " of " + table.Name,
+				alter + "DROP FOREIGN KEY " + quoteIdentifier(fk.Name) + ";"})
+		}
+	}
+
+	indexes := make(map[string]indexDesc, len(other.indexes))
+	for _, index := range other.indexes {
+		indexes[index.name] = index
+	}
+	var addedIndexes []indexDesc
+	for _, index := range table.indexes {
+		otherIndex, ok := indexes[index.name]
+		if ok && reflect.DeepEqual(index, otherIndex) {
+			delete(indexes, index.name)
+			continue
+		}
+		addedIndexes = append(addedIndexes, index)
+	}
+	for _, index := range other.indexes {
+		if _, ok := indexes[index.name]; ok {
+			changes = append(changes, schemaChange{table.Name, "drop index " + index.name + " of " + table.Name,
+				alter + "DROP INDEX " + quoteIdentifier(index.name) + ";"})
+		}
+	}
+
+	for _, field := range table.getFieldsArray() {
+		otherField, ok := other.fields[field.Name]
+		switch {
+		case !ok:
+			changes = append(changes, schemaChange{table.Name, "add column " + table.Name + "." + field.Name + " " + columnSummary(field),
+				alter + "ADD COLUMN " + columnStatement(field) + ";"})
+		case !strings.EqualFold(field.RawType, otherField.RawType) || field.Nullable != otherField.Nullable ||
+			isAutoIncrement(field) != isAutoIncrement(otherField):
+			changes = append(changes, schemaChange{table.Name,
+				"change column " + table.Name + "." + field.Name + " from " + columnSummary(otherField) + " to " + columnSummary(field),
+				alter + "MODIFY COLUMN " + columnStatement(field) + ";"})
+		}
+	}
+	for _, field := range other.getFieldsArray() {
+		if _, ok := table.fields[field.Name]; !ok {
+			changes = append(changes, schemaChange{table.Name, "drop column " + table.Name + "." + field.Name,
+				alter + "DROP COLUMN " + quoteIdentifier(field.Name) + ";"})
+		}
+	}
+
+	key, otherKey := primaryKeyColumns(table), primaryKeyColumns(other)
+	if !reflect.DeepEqual(key, otherKey) {
+		var clauses []string
+		if len(otherKey) > 0 {
+			clauses = append(clauses, "DROP PRIMARY KEY")
+		}
+		if len(key) > 0 {
+			clauses = append(clauses, "ADD PRIMARY KEY ("+quoteIdentifiers(key)+")")
+		}
+		changes = append(changes, schemaChange{table.Name,
+			fmt.Sprintf("change primary key of %s from (%s) to (%s)", table.Name, strings.Join(otherKey, ", "), strings.Join(key, ", ")),
+			alter + strings.Join(clauses, ", ") + ";"})
+	}
+
+	for _, index := range addedIndexes {
+		changes = append(changes, schemaChange{table.Name, "add index " + index.name + " of " + table.Name,
+			alter + "ADD " + indexStatement(index) + ";"})
+	}
+	return changes, addedKeys
+}
+
+func isAutoIncrement(field FieldDesc) bool {
+	return strings.Contains(strings.ToLower(field.Extra), "auto_increment")
+}
+
+//columnSummary describes a column like int NOT NULL auto_increment
+func columnSummary(field FieldDesc) string {
+	summary := field.RawType
+	if field.Nullable {
+		summary += " NULL"
+	} else {
+		summary += " NOT NULL"
+	}
+	if isAutoIncrement(field) {
+		summary += " auto_increment"
+	}
+	return summary
+}
+
+//columnStatement returns a definition of the column for CREATE and ALTER TABLE
+func columnStatement(field FieldDesc) string {
+	column := quoteIdentifier(field.Name) + " " + field.RawType
+	if field.Nullable {
+		column += " NULL"
+	} else {
+		column += " NOT NULL"
+	}
+	if isAutoIncrement(field) {
+		column += " AUTO_INCREMENT"
+	}
+	return column
+}
+
+//primaryKeyColumns returns columns of the primary key of the table in their order in the table
+func primaryKeyColumns(table TableDesc) []string {
+	var columns []string
+	for _, field := range table.getFieldsArray() {
+		if field.IsPrimaryKey {
+			columns = append(columns, field.Name)
+		}
+	}
+	return columns
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+//indexStatement returns a definition of the index for CREATE and ALTER TABLE
+func indexStatement(index indexDesc) string {
+	kind := "INDEX "
+	switch {
+	case index.kind == "FULLTEXT":
+		kind = "FULLTEXT INDEX "
+	case index.unique:
+		kind = "UNIQUE INDEX "
+	}
+	return kind + quoteIdentifier(index.name) + " (" + quoteIdentifiers(index.columns) + ")"
+}
+
+//createTableStatement returns CREATE TABLE of the table without its foreign keys
+func createTableStatement(table TableDesc) string {
+	var definitions []string
+	for _, field := range table.getFieldsArray() {
+		definitions = append(definitions, columnStatement(field))
+	}
+	if key := primaryKeyColumns(table); len(key) > 0 {
+		definitions = append(definitions, "PRIMARY KEY ("+quoteIdentifiers(key)+")")
+	}
+	for _, index := range table.indexes {
+		definitions = append(definitions, indexStatement(index))
+	}
+	return "CREATE TABLE " + quoteIdentifier(table.Name) + " (\n  " + strings.Join(definitions, ",\n  ") + "\n);"
+}
+
+func addForeignKeyChange(table TableDesc, fk ForeignKey) schemaChange {
+	statement := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteIdentifier(table.Name), quoteIdentifier(fk.Name), quoteIdentifiers(fk.Columns),
+		quoteIdentifier(fk.ReferencedTable), quoteIdentifiers(fk.ReferencedColumns))
+	if fk.OnUpdate != "" {
+		statement += " ON UPDATE " + fk.OnUpdate
+	}
+	if fk.OnDelete != "" {
+		statement += " ON DELETE " + fk.OnDelete
+	}
+	return schemaChange{table.Name, "add foreign key " + fk.Name + " of " + table.Name, statement + ";"}
+}
+
+//writeDiff writes a report of the changes as SQL, every statement follows its description in a comment
+func writeDiff(w io.Writer, changes []schemaChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "-- schemas are the same")
+		return err
+	}
+	for _, change := range changes {
+		_, err := fmt.Fprintf(w, "-- %s\n%s\n", change.Description, change.Statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//serveDiff compares the schema with a database named by WithDiffTarget
+//for GET /_admin/diff?against=name, changes make the schema of that database
+//the same as the current one
+func serveDiff(w http.ResponseWriter, r *http.Request, l *Router) {
+	name := r.URL.Query().Get("against")
+	if name == "" {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: "against is required"}.serve(w, r, l)
+		return
+	}
+	db, ok := l.diffTargets[name]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown database"}.serve(w, r, l)
+		return
+	}
+	against, err := initExplorer(db)
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{
+		"against": name,
+		"changes": diffSchemas(l.desc, *against),
+	}})
+}
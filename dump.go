@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//dumpInsertRows is a number of rows in a single INSERT statement of a dump
+const dumpInsertRows = 100
+
+//dumpHeader sets a session up the same way as dumps of Adminer do
+const dumpHeader = `-- db_explorer MySQL dump
+
+SET NAMES utf8;
+SET time_zone = '+00:00';
+SET foreign_key_checks = 0;
+SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
+
+`
+
+const contentTypeSQL = "application/sql"
+
+//queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+//quoteIdentifier quotes a name of a table or a column for MySQL
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+//quoteLiteral returns a MySQL literal of a decoded value of a field
+func quoteLiteral(v interface{}) string {
+	switch casted := v.(type) {
+	case nil:
+		return "NULL"
+	case int:
+		return strconv.Itoa(casted)
+	case string:
+		var buf strings.Builder
+		buf.WriteByte('\'')
+		for i := 0; i < len(casted); i++ {
+			switch c := casted[i]; c {
+			case 0:
+				buf.WriteString(`\0`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\x1a':
+				buf.WriteString(`\Z`)
+			case '\'', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteByte('\'')
+		return buf.String()
+	default:
+		return quoteLiteral(fmt.Sprint(casted))
+	}
+}
+
+//dumpTables returns names of the tables of the dump in the order of GET /,
+//views follow all the base tables they may select from.
+//All the tables are dumped if names are empty
+func dumpTables(desc DbDesc, names []string) ([]string, error) {
+	if len(names) == 0 {
+		for name := range desc.tables {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if _, ok := desc.tables[name]; !ok {
+			return nil, fmt.Errorf("unknown table %s", name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		iView, jView := desc.tables[names[i]].isView(), desc.tables[names[j]].isView()
+		if iView != jView {
+			return jView
+		}
+		return names[i] < names[j]
+	})
+	return names, nil
+}
+
+//writeDump writes DROP TABLE, CREATE TABLE and INSERT statements of the tables to w,
+//views are written without rows
+func writeDump(ctx context.Context, q queryer, w io.Writer, desc DbDesc, tables []string) error {
+	_, err := io.WriteString(w, dumpHeader)
+	if err != nil {
+		return err
+	}
+	for _, name := range tables {
+		err = writeTableDump(ctx, q, w, desc.tables[name])
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "-- %s\n", time.Now().UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func writeTableDump(ctx context.Context, q queryer, w io.Writer, table TableDesc) error {
+	createStmt, err := showCreateTable(ctx, q, table.Name)
+	if err != nil {
+		return err
+	}
+	if table.isView() {
+		_, err = fmt.Fprintf(w, "DROP VIEW IF EXISTS %s;\n%s;\n\n", quoteIdentifier(table.Name), createStmt)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "DROP TABLE IF EXISTS %s;\n%s;\n\n", quoteIdentifier(table.Name), createStmt)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+quoteIdentifier(table.Name))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+
+	codec, err := newRowCodec(table, rows)
+	if err != nil {
+		return err
+	}
+	quotedCols := make([]string, len(codec.cols))
+	for i, col := range codec.cols {
+		quotedCols[i] = quoteIdentifier(col)
+	}
+	insertStart := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteIdentifier(table.Name), strings.Join(quotedCols, ", "))
+
+	rowsInStmt := 0
+	for rows.Next() {
+		values, err := codec.scanValues(rows)
+		if err != nil {
+			return err
+		}
+		literals := make([]string, len(values))
+		for i, value := range values {
+			literals[i] = quoteLiteral(value)
+		}
+
+		prefix := ",\n"
+		if rowsInStmt == 0 {
+			prefix = insertStart
+		}
+		_, err = io.WriteString(w, prefix+"("+strings.Join(literals, ",\t")+")")
+		if err != nil {
+			return err
+		}
+		rowsInStmt++
+		if rowsInStmt == dumpInsertRows {
+			_, err = io.WriteString(w, ";\n")
+			if err != nil {
+				return err
+			}
+			rowsInStmt = 0
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if rowsInStmt > 0 {
+		_, err = io.WriteString(w, ";\n")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+//showCreateTable returns a CREATE statement of the table
+func showCreateTable(ctx context.Context, q queryer, name string) (string, error) {
+	rows, err := q.QueryContext(ctx, "SHOW CREATE TABLE "+quoteIdentifier(name))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	//views have additional columns, the statement is always the second one
+	vals := make([]interface{}, len(cols))
+	for i := range vals {
+		vals[i] = new(sql.RawBytes)
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no CREATE statement for %s", name)
+	}
+	err = rows.Scan(vals...)
+	if err != nil {
+		return "", err
+	}
+	return string(*vals[1].(*sql.RawBytes)), nil
+}
+
+//restoreDump executes statements of the dump inside a transaction and returns
+//a number of executed statements. MySQL commits DDL statements implicitly,
+//so the rollback after a failed statement covers data changes only.
+//The dump sets session variables like foreign_key_checks, so its connection
+//is closed afterwards instead of returning to the pool
+func restoreDump(ctx context.Context, db *sql.DB, dump io.Reader) (int, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer discardConn(conn)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	scanner := newStatementScanner(dump)
+	executed := 0
+	for {
+		stmt, err := scanner.next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, stmt)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Println("rollback error:", rbErr)
+			}
+			return executed, restoreError{Statement: executed + 1, Err: err}
+		}
+		executed++
+	}
+	return executed, tx.Commit()
+}
+
+//discardConn closes the connection instead of returning it to the pool,
+//so its session state doesn't affect later requests
+func discardConn(conn *sql.Conn) {
+	//driver.ErrBadConn returned by Raw makes database/sql close the connection
+	conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	conn.Close()
+}
+
+//dumpSyntaxError is an error of splitting a dump into statements
+type dumpSyntaxError string
+
+func (sErr dumpSyntaxError) Error() string {
+	return string(sErr)
+}
+
+//restoreError is an error of a statement of a restored dump
+type restoreError struct {
+	Statement int
+	Err       error
+}
+
+func (rErr restoreError) Error() string {
+	return fmt.Sprintf("statement %d: %s", rErr.Statement, rErr.Err.Error())
+}
+
+func (rErr restoreError) Unwrap() error {
+	return rErr.Err
+}
+
+//statementScanner splits a dump into statements by semicolons
+//outside of quotes and comments, comments are dropped
+type statementScanner struct {
+	reader *bufio.Reader
+}
+
+func newStatementScanner(dump io.Reader) *statementScanner {
+	return &statementScanner{reader: bufio.NewReader(dump)}
+}
+
+//next returns the next statement without the trailing semicolon, io.EOF at the end
+func (scanner *statementScanner) next() (string, error) {
+	var stmt strings.Builder
+	var quote byte
+	for {
+		c, err := scanner.reader.ReadByte()
+		if err == io.EOF {
+			if quote != 0 {
+				return "", dumpSyntaxError("unterminated quote " + string(quote))
+			}
+			if rest := strings.TrimSpace(stmt.String()); rest != "" {
+				return rest, nil
+			}
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if quote != 0 {
+			stmt.WriteByte(c)
+			switch {
+			case c == '\\' && quote != '`':
+				escaped, err := scanner.reader.ReadByte()
+				if err != nil {
+					return "", dumpSyntaxError("unterminated quote " + string(quote))
+				}
+				stmt.WriteByte(escaped)
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			stmt.WriteByte(c)
+		case ';':
+			if s := strings.TrimSpace(stmt.String()); s != "" {
+				return s, nil
+			}
+		case '#':
+			err = scanner.skipLine()
+		case '-':
+			if scanner.peekIs("- ") || scanner.peekIs("-\n") || scanner.peekIs("-\t") {
+				err = scanner.skipLine()
+			} else {
+				stmt.WriteByte(c)
+			}
+		case '/':
+			if scanner.peekIs("*") {
+				err = scanner.skipBlockComment()
+			} else {
+				stmt.WriteByte(c)
+			}
+		default:
+			stmt.WriteByte(c)
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+}
+
+func (scanner *statementScanner) peekIs(s string) bool {
+	data, _ := scanner.reader.Peek(len(s))
+	return string(data) == s
+}
+
+func (scanner *statementScanner) skipLine() error {
+	_, err := scanner.reader.ReadString('\n')
+	return err
+}
+
+func (scanner *statementScanner) skipBlockComment() error {
+	_, err := scanner.reader.ReadByte() // '*'
+	if err != nil {
+		return err
+	}
+	var prev byte
+	for {
+		c, err := scanner.reader.ReadByte()
+		if err != nil {
+			return dumpSyntaxError("unterminated comment")
+		}
+		if prev == '*' && c == '/' {
+			return nil
+		}
+		prev = c
+	}
+}
+
+//lazyWriter sets headers of an answer on the first write,
+//so errors which happen before it can still be served with a proper status
+type lazyWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (lw *lazyWriter) Write(data []byte) (int, error) {
+	if !lw.started {
+		lw.started = true
+		lw.w.Header().Set("Content-Type", lw.contentType)
+		lw.w.WriteHeader(http.StatusOK)
+	}
+	return lw.w.Write(data)
+}
+
+//serveDump serves GET /_dump, names of dumped tables can be passed by the tables parameter
+func serveDump(w http.ResponseWriter, r *http.Request, l *Router) {
+	var names []string
+	if param := r.URL.Query().Get("tables"); param != "" {
+		names = strings.Split(param, ",")
+	}
+	tables, err := dumpTables(l.desc, names)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+
+	ctx, cancel := l.requestContext(r, RouteDump)
+	defer cancel()
+	//a read only transaction gives a consistent snapshot of all the tables
+	tx, err := l.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Println("rollback error:", err)
+		}
+	}()
+
+	lw := &lazyWriter{w: w, contentType: contentTypeSQL + "; charset=utf-8"}
+	bw := bufio.NewWriter(lw)
+	err = writeDump(ctx, tx, bw, l.desc, tables)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		log.Println("can't dump:", err)
+		if !lw.started {
+			dbError(err).serve(w, r, l)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+//serveRestore serves POST /_dump replaying a dump from the body
+func serveRestore(w http.ResponseWriter, r *http.Request, l *Router) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != contentTypeSQL && mediaType != "text/plain") {
+			bodyError(unsupportedContentTypeError{contentType}).serve(w, r, l)
+			return
+		}
+	}
+
+	ctx, cancel := l.requestContext(r, RouteRestore)
+	defer cancel()
+	executed, err := restoreDump(ctx, l.db, r.Body)
+	if err != nil {
+		log.Println("can't restore a dump:", err)
+		rErr := statementError(err)
+		var syntaxErr dumpSyntaxError
+		if errors.As(err, &syntaxErr) {
+			rErr = RespError{HTTPStatus: http.StatusBadRequest, Error: syntaxErr.Error()}
+		}
+		if stmtErr, ok := err.(restoreError); ok && rErr.HTTPStatus != http.StatusInternalServerError {
+			rErr.Error = fmt.Sprintf("statement %d: %s", stmtErr.Statement, rErr.Error)
+		}
+		rErr.serve(w, r, l)
+		return
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"statements": executed}})
+}
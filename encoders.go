@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeXML           = "application/xml"
+	contentTypeProblemXML    = "application/problem+xml"
+	contentTypeMsgpack       = "application/msgpack"
+	contentTypeMsgpackLegacy = "application/x-msgpack"
+	contentTypeCBOR          = "application/cbor"
+)
+
+//ResponseEncoder encodes answers of the API into a media type
+type ResponseEncoder struct {
+	MediaType string
+	//ProblemMediaType is a media type of errors in the RFC 7807 form,
+	//MediaType is used for them if it's empty
+	ProblemMediaType string
+	Encode           func(v interface{}) ([]byte, error)
+}
+
+//WithEncoder registers an encoder of answers, it replaces a registered
+//encoder of the same media type
+func WithEncoder(enc ResponseEncoder) Option {
+	return func(l *Router) {
+		for i := range l.encoders {
+			if l.encoders[i].MediaType == enc.MediaType {
+				l.encoders[i] = enc
+				return
+			}
+		}
+		l.encoders = append(l.encoders, enc)
+	}
+}
+
+//defaultEncoders returns encoders every Router has, JSON is preferred
+//when a client accepts anything
+func defaultEncoders() []ResponseEncoder {
+	return []ResponseEncoder{
+		{MediaType: contentTypeJSON, ProblemMediaType: contentTypeProblem, Encode: json.Marshal},
+		{MediaType: contentTypeXML, ProblemMediaType: contentTypeProblemXML, Encode: encodeXML},
+		{MediaType: contentTypeMsgpack, Encode: encodeMsgpack},
+		{MediaType: contentTypeMsgpackLegacy, Encode: encodeMsgpack},
+		{MediaType: contentTypeCBOR, Encode: encodeCBOR},
+	}
+}
+
+//negotiateEncoder returns the encoder preferred by the Accept header of the request
+//and whether the client asked for errors in the RFC 7807 form.
+//JSON is used if the client doesn't accept any of the encoders
+func (l *Router) negotiateEncoder(r *http.Request) (ResponseEncoder, bool) {
+	offers := make([]string, 0, len(l.encoders)*2)
+	for _, enc := range l.encoders {
+		offers = append(offers, enc.MediaType)
+	}
+	for _, enc := range l.encoders {
+		if enc.ProblemMediaType != "" {
+			offers = append(offers, enc.ProblemMediaType)
+		}
+	}
+	chosen := negotiate(r.Header.Get("Accept"), offers)
+	for _, enc := range l.encoders {
+		if chosen == enc.MediaType {
+			return enc, false
+		}
+		if chosen == enc.ProblemMediaType && chosen != "" {
+			return enc, true
+		}
+	}
+	return l.encoders[0], false
+}
+
+//mediaRange is a media range of the Accept header with its quality
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+	return ranges
+}
+
+//negotiate returns the offer with the highest quality in the Accept header,
+//offers go in the order of preference of the server. The first offer is returned
+//for an empty header and "" if no offer is acceptable
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(accept)
+	best := ""
+	bestQ := 0.0
+	for _, offer := range offers {
+		//the most specific range matching the offer defines its quality
+		q, specificity := 0.0, -1
+		offerType := offer[:strings.Index(offer+"/", "/")]
+		for _, rng := range ranges {
+			matched := -1
+			switch {
+			case rng.mediaType == offer:
+				matched = 2
+			case rng.mediaType == offerType+"/*":
+				matched = 1
+			case rng.mediaType == "*/*":
+				matched = 0
+			}
+			if matched > specificity {
+				q, specificity = rng.q, matched
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+//plainField is a member of plainObject
+type plainField struct {
+	Key   string
+	Value interface{}
+}
+
+//plainObject is a map or a struct with ordered members
+type plainObject []plainField
+
+//plainValue converts v to nil, bool, int64, uint64, float64, string, []byte,
+//[]interface{} or plainObject, so encoders don't have to deal with reflection.
+//Fields of structs are named by their json tags, keys of maps are sorted
+func plainValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return plainReflectValue(reflect.ValueOf(v))
+}
+
+func plainReflectValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return plainReflectValue(v.Elem())
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return data
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = plainReflectValue(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		for _, key := range v.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			keys = append(keys, name)
+			values[name] = v.MapIndex(key)
+		}
+		sort.Strings(keys)
+		obj := make(plainObject, len(keys))
+		for i, key := range keys {
+			obj[i] = plainField{key, plainReflectValue(values[key])}
+		}
+		return obj
+	case reflect.Struct:
+		obj := make(plainObject, 0, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			omitEmpty := false
+			if tag := field.Tag.Get("json"); tag != "" {
+				parts := strings.Split(tag, ",")
+				if parts[0] == "-" {
+					continue
+				}
+				if parts[0] != "" {
+					name = parts[0]
+				}
+				for _, opt := range parts[1:] {
+					omitEmpty = omitEmpty || opt == "omitempty"
+				}
+			}
+			if omitEmpty && isEmptyValue(v.Field(i)) {
+				continue
+			}
+			obj = append(obj, plainField{name, plainReflectValue(v.Field(i))})
+		}
+		return obj
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+//isEmptyValue reports whether the value is omitted by the omitempty option of json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const contentTypeProblem = "application/problem+json"
+
+//allowedMethods is a value of the Allow header for http.StatusMethodNotAllowed answers
+const allowedMethods = "GET, POST, PUT, DELETE"
+
+//Types of problems, "about:blank" is used when a status code describes a problem well enough
+const (
+	problemTypeBlank          = "about:blank"
+	problemTypeInvalidField   = "urn:problem-type:invalid-field"
+	problemTypeDuplicateEntry = "urn:problem-type:duplicate-entry"
+	problemTypeForeignKey     = "urn:problem-type:foreign-key-violation"
+	problemTypeDataTooLong    = "urn:problem-type:data-too-long"
+	problemTypeInvalidFilter  = "urn:problem-type:invalid-filter"
+)
+
+//Codes of MySQL errors which are caused by a client
+const (
+	mysqlErrParse           = 1064
+	mysqlErrDuplicateEntry  = 1062
+	mysqlErrBadNull         = 1048
+	mysqlErrDataTooLong     = 1406
+	mysqlErrRowIsReferenced = 1451
+	mysqlErrNoReferencedRow = 1452
+)
+
+//RespError represents an error of API
+type RespError struct {
+	Error      string
+	HTTPStatus int
+	//Type is a problem type, problemTypeBlank is used if it's empty
+	Type string
+	//Fields contains errors of particular fields of a request
+	Fields []FieldError
+}
+
+//FieldError describes an invalid field of a request
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+//Problem is an answer with the error in the RFC 7807 form
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+//PrepApiAnswer returns bytes for an answer with the error
+func (rErr RespError) PrepApiAnswer() []byte {
+	data, err := json.Marshal(map[string]string{"error": rErr.Error})
+	if err != nil {
+		log.Println("can't json.Marshal an error:", err)
+		return []byte(`{"error":"Internal Server Error"}`)
+	}
+	return data
+}
+
+//PrepProblem returns the error as a Problem of the instance
+func (rErr RespError) PrepProblem(instance string) Problem {
+	problemType := rErr.Type
+	if problemType == "" {
+		problemType = problemTypeBlank
+	}
+	return Problem{
+		Type:     problemType,
+		Title:    http.StatusText(rErr.HTTPStatus),
+		Status:   rErr.HTTPStatus,
+		Detail:   rErr.Error,
+		Instance: instance,
+		Errors:   rErr.Fields,
+	}
+}
+
+//This function writes a RespError to a passed http.ResponseWriter by the negotiated encoder,
+//the legacy {"error": ...} shape is used unless the Router or the client asks for problems
+func (rErr RespError) serve(w http.ResponseWriter, r *http.Request, l *Router) {
+	if l.representation(r) == contentTypeJSONAPI {
+		serveRepresentation(w, contentTypeJSONAPI, rErr.HTTPStatus, rErr.jsonAPIErrors())
+		return
+	}
+	enc, askedProblem := l.negotiateEncoder(r)
+	var body interface{} = map[string]string{"error": rErr.Error}
+	contentType := enc.MediaType
+	if !l.legacyErrors || askedProblem {
+		body = rErr.PrepProblem(r.URL.Path)
+		if enc.ProblemMediaType != "" {
+			contentType = enc.ProblemMediaType
+		}
+	}
+	apiData, err := enc.Encode(body)
+	if err != nil {
+		log.Println("can't encode an error:", err)
+		apiData = rErr.PrepApiAnswer()
+		contentType = contentTypeJSON
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(rErr.HTTPStatus)
+	_, err = w.Write(apiData)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+//bodyError converts an error of decoding a request body to an error of API
+func bodyError(err error) RespError {
+	var typeErr fieldTypeError
+	var contentTypeErr unsupportedContentTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return RespError{
+			HTTPStatus: http.StatusBadRequest,
+			Error:      typeErr.Error(),
+			Type:       problemTypeInvalidField,
+			Fields:     []FieldError{{Field: typeErr.Field, Detail: "invalid type"}},
+		}
+	case errors.As(err, &contentTypeErr):
+		return RespError{HTTPStatus: http.StatusUnsupportedMediaType, Error: contentTypeErr.Error()}
+	default:
+		return RespError{HTTPStatus: http.StatusBadRequest, Error: "can't parse a body"}
+	}
+}
+
+//dbError converts an error of a database to an error of API,
+//errors which aren't caused by a client are reported as http.StatusInternalServerError
+//and expired timeouts of requests as http.StatusGatewayTimeout
+func dbError(err error) RespError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return RespError{HTTPStatus: http.StatusGatewayTimeout, Error: "database timeout"}
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}
+	}
+	switch mysqlErr.Number {
+	case mysqlErrDuplicateEntry:
+		return RespError{HTTPStatus: http.StatusConflict, Error: mysqlErr.Message, Type: problemTypeDuplicateEntry}
+	case mysqlErrRowIsReferenced:
+		return RespError{HTTPStatus: http.StatusConflict, Error: mysqlErr.Message, Type: problemTypeForeignKey}
+	case mysqlErrNoReferencedRow:
+		return RespError{HTTPStatus: http.StatusUnprocessableEntity, Error: mysqlErr.Message, Type: problemTypeForeignKey}
+	case mysqlErrDataTooLong, mysqlErrBadNull:
+		rErr := RespError{HTTPStatus: http.StatusBadRequest, Error: mysqlErr.Message, Type: problemTypeInvalidField}
+		if mysqlErr.Number == mysqlErrDataTooLong {
+			rErr.Type = problemTypeDataTooLong
+		}
+		if column := quotedColumn(mysqlErr.Message); column != "" {
+			rErr.Fields = []FieldError{{Field: column, Detail: mysqlErr.Message}}
+		}
+		return rErr
+	default:
+		return RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}
+	}
+}
+
+//statementError converts an error of a statement written by a client, like ones of dumps
+//and migrations, syntax errors of them are served with their messages
+func statementError(err error) RespError {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrParse {
+		return RespError{HTTPStatus: http.StatusBadRequest, Error: mysqlErr.Message}
+	}
+	return dbError(err)
+}
+
+//quotedColumn returns a name of a column from messages like "Data too long for column 'title' at row 1"
+func quotedColumn(message string) string {
+	start := strings.Index(strings.ToLower(message), "column '")
+	if start < 0 {
+		return ""
+	}
+	rest := message[start+len("column '"):]
+	end := strings.Index(rest, "'")
+	if end < 0 {
+		return ""
+	}
+	return rest[:end]
+}
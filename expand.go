@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+//unknownRelationError is returned for names of relations the table doesn't have
+type unknownRelationError struct {
+	Name string
+}
+
+func (relErr unknownRelationError) Error() string {
+	return "unknown relation " + relErr.Name
+}
+
+//parseExpand returns relations of the table listed by the expand parameter of the request,
+//like ?expand=author,comments
+func parseExpand(r *http.Request, table TableDesc) ([]relation, error) {
+	var rels []relation
+	for _, value := range r.URL.Query()["expand"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			rel := table.relation(name)
+			if rel == nil {
+				return nil, unknownRelationError{name}
+			}
+			rels = append(rels, *rel)
+		}
+	}
+	return rels, nil
+}
+
+//relationColumns returns columns of a row and matching columns of its related rows
+func (rel relation) relationColumns() (from []string, to []string) {
+	if rel.toParent {
+		return rel.fk.Columns, rel.fk.ReferencedColumns
+	}
+	return rel.fk.ReferencedColumns, rel.fk.Columns
+}
+
+//tupleKey returns a key of values of the columns of the row, false is returned
+//if one of them is NULL so the row doesn't have related rows
+func tupleKey(row map[string]interface{}, columns []string) (string, []interface{}, bool) {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if row[column] == nil {
+			return "", nil, false
+		}
+		values[i] = row[column]
+	}
+	key, _ := json.Marshal(values)
+	return string(key), values, true
+}
+
+//queryRelated returns rows related by the relation to the rows grouped by keys of their values
+//of columns of the relation. q selects the related rows, it gets a condition on the columns
+func queryRelated(ctx context.Context, db queryer, related TableDesc, rel relation, rows []map[string]interface{}, q *selectQuery) (map[string][]interface{}, error) {
+	from, to := rel.relationColumns()
+	seen := make(map[string]bool)
+	tuples := make([][]interface{}, 0)
+	for _, row := range rows {
+		if key, values, ok := tupleKey(row, from); ok && !seen[key] {
+			seen[key] = true
+			tuples = append(tuples, values)
+		}
+	}
+
+	grouped := make(map[string][]interface{})
+	if len(tuples) == 0 {
+		return grouped, nil
+	}
+	q.whereTuplesIn(to, tuples)
+	relatedRows, err := queryRows(ctx, db, related, q)
+	if err != nil {
+		return nil, err
+	}
+	for _, relatedRow := range relatedRows {
+		key, _, _ := tupleKey(relatedRow, to)
+		grouped[key] = append(grouped[key], relatedRow)
+	}
+	return grouped, nil
+}
+
+//expandRows embeds rows related by the relations into rows under names of the relations:
+//a parent row or null and an array of no more than limit first child rows, zero limit
+//means all of them. Related rows of all rows are read by a single query per relation
+func expandRows(ctx context.Context, db queryer, desc DbDesc, rels []relation, rows []map[string]interface{}, limit int) error {
+	for _, rel := range rels {
+		related := desc.tables[rel.table]
+		from, to := rel.relationColumns()
+
+		q := newSelectQuery(related.Name)
+		if keyField := related.getKeyField(); keyField != nil {
+			q.addOrder(keyField.Name, false)
+		}
+		if !rel.toParent && limit > 0 {
+			q.limit = limit
+			q.limitPerGroup(related, to)
+		}
+		grouped, err := queryRelated(ctx, db, related, rel, rows, q)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			key, _, _ := tupleKey(row, from)
+			found := grouped[key]
+			if rel.toParent {
+				row[rel.name] = nil
+				if len(found) > 0 {
+					row[rel.name] = found[0]
+				}
+			} else {
+				if found == nil {
+					found = make([]interface{}, 0)
+				}
+				row[rel.name] = found
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+//Formats of list answers which can be chosen by the format parameter
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatTSV    = "tsv"
+	formatXLSX   = "xlsx"
+)
+
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+	contentTypeTSV    = "text/tab-separated-values"
+	contentTypeXLSX   = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+//WithExportNull sets a representation of NULL in CSV, TSV and XLSX exports
+//and CSV, TSV imports, it's an empty string by default and can be overridden
+//by the null parameter
+func WithExportNull(null string) Option {
+	return func(l *Router) {
+		l.exportNull = null
+	}
+}
+
+//nullRepresentation returns a representation of NULL in text files
+//set by the null parameter or WithExportNull
+func (l *Router) nullRepresentation(r *http.Request) string {
+	if values, ok := r.URL.Query()["null"]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return l.exportNull
+}
+
+//listFormat returns a format of a list answer chosen by the format parameter
+//or the Accept header, false is returned for unknown formats. Media types of
+//registered encoders are returned as formats when the client prefers them
+func (l *Router) listFormat(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case formatJSON, formatNDJSON, formatCSV, formatTSV, formatXLSX:
+			return format, true
+		}
+		return "", false
+	}
+
+	formats := map[string]string{
+		contentTypeJSON:   formatJSON,
+		contentTypeNDJSON: formatNDJSON,
+		contentTypeCSV:    formatCSV,
+		contentTypeTSV:    formatTSV,
+		contentTypeXLSX:   formatXLSX,
+	}
+	offers := []string{contentTypeJSON, contentTypeNDJSON, contentTypeCSV, contentTypeTSV, contentTypeXLSX}
+	for _, enc := range l.encoders {
+		if _, ok := formats[enc.MediaType]; !ok {
+			offers = append(offers, enc.MediaType)
+		}
+	}
+	chosen := negotiate(r.Header.Get("Accept"), offers)
+	if chosen == "" {
+		return formatJSON, true
+	}
+	if format, ok := formats[chosen]; ok {
+		return format, true
+	}
+	return chosen, true
+}
+
+//newRowEncoder returns an encoder of rows of the table in the format the client asked for,
+//limit and offset of the page are used by links of JSON:API and HAL collections
+func newRowEncoder(w http.ResponseWriter, r *http.Request, l *Router, table TableDesc, limit int, offset int) (rowEncoder, bool) {
+	format, ok := l.listFormat(r)
+	if !ok {
+		return nil, false
+	}
+
+	null := l.nullRepresentation(r)
+	fields := table.getFieldsArray()
+
+	switch format {
+	case formatJSON:
+		if representation := l.representation(r); representation != "" {
+			return newResourceEncoder(w, r, l, representation, table, limit, offset), true
+		}
+		return newJSONEncoder(w), true
+	case formatNDJSON:
+		return newNDJSONEncoder(w), true
+	case formatCSV:
+		return newCSVEncoder(w, table.Name+".csv", contentTypeCSV, ',', fields, null), true
+	case formatTSV:
+		return newCSVEncoder(w, table.Name+".tsv", contentTypeTSV, '\t', fields, null), true
+	case formatXLSX:
+		return &xlsxEncoder{w: w, table: table.Name, fields: fields, null: null}, true
+	default:
+		return &bufferedEncoder{w: w, r: r, l: l, rows: make([]interface{}, 0)}, true
+	}
+}
+
+//exportValue formats a decoded value of a field for text exports
+func exportValue(v interface{}, null string) string {
+	switch casted := v.(type) {
+	case nil:
+		return null
+	case string:
+		return casted
+	case int:
+		return strconv.Itoa(casted)
+	default:
+		return fmt.Sprint(casted)
+	}
+}
+
+//startAttachment writes headers of an exported file
+func startAttachment(w http.ResponseWriter, contentType string, fileName string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	w.WriteHeader(http.StatusOK)
+}
+
+//csvEncoder writes rows as CSV or TSV with a header row of the table fields
+type csvEncoder struct {
+	w           http.ResponseWriter
+	csvW        *csv.Writer
+	fileName    string
+	contentType string
+	fields      []FieldDesc
+	null        string
+	started     bool
+}
+
+func newCSVEncoder(w http.ResponseWriter, fileName string, contentType string, comma rune, fields []FieldDesc, null string) *csvEncoder {
+	csvW := csv.NewWriter(w)
+	csvW.Comma = comma
+	return &csvEncoder{w: w, csvW: csvW, fileName: fileName, contentType: contentType, fields: fields, null: null}
+}
+
+func (enc *csvEncoder) start() error {
+	enc.started = true
+	startAttachment(enc.w, enc.contentType, enc.fileName)
+	header := make([]string, len(enc.fields))
+	for i, field := range enc.fields {
+		header[i] = field.Name
+	}
+	return enc.csvW.Write(header)
+}
+
+func (enc *csvEncoder) isStarted() bool {
+	return enc.started
+}
+
+func (enc *csvEncoder) writeRow(row map[string]interface{}) error {
+	if !enc.started {
+		err := enc.start()
+		if err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(enc.fields))
+	for i, field := range enc.fields {
+		record[i] = exportValue(row[field.Name], enc.null)
+	}
+	return enc.csvW.Write(record)
+}
+
+func (enc *csvEncoder) finish() error {
+	if !enc.started {
+		err := enc.start()
+		if err != nil {
+			return err
+		}
+	}
+	enc.csvW.Flush()
+	return enc.csvW.Error()
+}
+
+//Static parts of a workbook with the single sheet xl/worksheets/sheet1.xml
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+//maxSheetNameLength is a limit of Excel for names of sheets
+const maxSheetNameLength = 31
+
+//xlsxEncoder writes rows as a single sheet workbook, the sheet is
+//the last part of the zip archive so its rows are streamed as well
+type xlsxEncoder struct {
+	w       http.ResponseWriter
+	zipW    *zip.Writer
+	sheet   io.Writer
+	table   string
+	fields  []FieldDesc
+	null    string
+	started bool
+	rows    int
+}
+
+//sheetName returns a name of a sheet of rows of the table,
+//it's cut to the limit of characters without splitting them
+func sheetName(table string) string {
+	runes := []rune(table)
+	if len(runes) > maxSheetNameLength {
+		return string(runes[:maxSheetNameLength])
+	}
+	return table
+}
+
+func (enc *xlsxEncoder) start() error {
+	enc.started = true
+	startAttachment(enc.w, contentTypeXLSX, enc.table+".xlsx")
+	enc.zipW = zip.NewWriter(enc.w)
+
+	parts := []struct {
+		name, content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName(enc.table)))},
+	}
+	for _, part := range parts {
+		partW, err := enc.zipW.Create(part.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(partW, part.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	enc.sheet, err = enc.zipW.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(enc.sheet, xlsxSheetStart)
+	if err != nil {
+		return err
+	}
+	header := make([]interface{}, len(enc.fields))
+	for i, field := range enc.fields {
+		header[i] = field.Name
+	}
+	return enc.writeCells(header)
+}
+
+func (enc *xlsxEncoder) isStarted() bool {
+	return enc.started
+}
+
+func (enc *xlsxEncoder) writeRow(row map[string]interface{}) error {
+	if !enc.started {
+		err := enc.start()
+		if err != nil {
+			return err
+		}
+	}
+	cells := make([]interface{}, len(enc.fields))
+	for i, field := range enc.fields {
+		cells[i] = row[field.Name]
+		if cells[i] == nil && enc.null != "" {
+			cells[i] = enc.null
+		}
+	}
+	return enc.writeCells(cells)
+}
+
+//writeCells writes a row of the sheet, numbers are stored as numeric cells,
+//other values as inline strings and nil values are skipped
+func (enc *xlsxEncoder) writeCells(cells []interface{}) error {
+	enc.rows++
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, enc.rows)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(enc.rows)
+		switch casted := cell.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(&buf, `<c r="%s"><v>%d</v></c>`, ref, casted)
+		default:
+			fmt.Fprintf(&buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+				ref, xmlEscape(exportValue(casted, "")))
+		}
+	}
+	buf.WriteString(`</row>`)
+	_, err := enc.sheet.Write(buf.Bytes())
+	return err
+}
+
+func (enc *xlsxEncoder) finish() error {
+	if !enc.started {
+		err := enc.start()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(enc.sheet, xlsxSheetEnd)
+	if err != nil {
+		return err
+	}
+	return enc.zipW.Close()
+}
+
+//xlsxColumn returns a name of a column of a sheet by its zero based index: A, B, ..., Z, AA, ...
+func xlsxColumn(idx int) string {
+	name := ""
+	for idx >= 0 {
+		name = string(rune('A'+idx%26)) + name
+		idx = idx/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
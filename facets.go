@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+//defaultFacetSize is a number of the most frequent values of a facet if facet_size isn't set
+const defaultFacetSize = 10
+
+//facetEncoder is implemented by row encoders which can serve facets along with rows,
+//false is returned by encoders of formats without a place for them
+type facetEncoder interface {
+	setFacets(facets map[string]interface{}) bool
+}
+
+//parseFacets returns columns of the facets parameter, like ?facets=updated,title
+func parseFacets(query url.Values, table TableDesc) ([]string, error) {
+	columns := listParam(query, "facets")
+	for _, column := range columns {
+		if _, ok := table.fields[column]; !ok {
+			return nil, aggregateError{"unknown column " + column}
+		}
+	}
+	return columns, nil
+}
+
+//queryFacets returns the most frequent values of the columns with their counts
+//among rows matching conditions of the query, more frequent values go first
+func (l *Router) queryFacets(ctx context.Context, query url.Values, table TableDesc, filtered *selectQuery, columns []string) (map[string]interface{}, error) {
+	size, _ := strconv.Atoi(getIntValueAsStringFromQuery(query, "facet_size", strconv.Itoa(defaultFacetSize)))
+	if l.maxLimit > 0 && (size > l.maxLimit || size < 0) {
+		size = l.maxLimit
+	}
+	facets := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		//aliases don't clash with the column whatever its name is, like count
+		aggs := []aggregate{{column: column, alias: "value"}, {function: "count", column: "*", alias: "count"}}
+		q := filtered.filtered()
+		q.limit = size
+		q.selectAggregates(aggs)
+		q.orderBy = []string{"COUNT(*) DESC", quoteIdentifier(column)}
+		rows, err := queryAggregates(ctx, l.db, table, q, aggs)
+		if err != nil {
+			return nil, err
+		}
+		facets[column] = rows
+	}
+	return facets, nil
+}
+
+func (enc *listEncoder) setFacets(facets map[string]interface{}) bool {
+	if !enc.hasResponse {
+		return false
+	}
+	data, _ := json.Marshal(facets)
+	enc.suffix = `],"facets":` + string(data) + `}}`
+	return true
+}
+
+func (enc *bufferedEncoder) setFacets(facets map[string]interface{}) bool {
+	enc.facets = facets
+	return true
+}
+
+func (enc *resourceEncoder) setFacets(facets map[string]interface{}) bool {
+	enc.facets = facets
+	return true
+}
+
+//serveDistinct serves distinct values of the column among rows of the table
+//in ascending order, rows are filtered by filter and q like listed ones,
+//like GET /items/_distinct/updated
+func serveDistinct(w http.ResponseWriter, r *http.Request, l *Router, tableName string, column string) {
+	table, ok := l.desc.tables[tableName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	if _, ok = table.fields[column]; !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown column"}.serve(w, r, l)
+		return
+	}
+	query := r.URL.Query()
+	q := newSelectQuery(table.Name)
+	_, err := filterRows(query, table, q)
+	if err != nil {
+		filterRespError(err).serve(w, r, l)
+		return
+	}
+	aggs := []aggregate{{column: column}}
+	q.selectAggregates(aggs)
+	q.addOrder(column, false)
+	q.limit = l.groupLimit(query)
+	q.offset, _ = strconv.Atoi(getIntValueAsStringFromQuery(query, "offset", "0"))
+
+	ctx, cancel := l.requestContext(r, RouteListRows)
+	defer cancel()
+	rows, err := queryAggregates(ctx, l.db, table, q, aggs)
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return
+	}
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row[column]
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"values": values}})
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//maxFilterDepth limits nesting of parentheses and negations of a filter
+const maxFilterDepth = 20
+
+//Kinds of tokens of a filter
+const (
+	filterEOF = iota
+	filterLParen
+	filterRParen
+	//filterAnd is ; and filterOr is , while words and, or are filterWord
+	filterAnd
+	filterOr
+	filterOperator
+	filterWord
+	filterString
+)
+
+//filterToken is a token of a filter, pos is a position of its first character counted from 1
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+func (tok filterToken) String() string {
+	switch tok.kind {
+	case filterEOF:
+		return "end of filter"
+	case filterString:
+		return strconv.Quote(tok.text)
+	default:
+		return "'" + tok.text + "'"
+	}
+}
+
+//filterError is an error of a filter at the position of its character counted from 1
+type filterError struct {
+	message string
+	pos     int
+}
+
+func (fErr filterError) Error() string {
+	return fmt.Sprintf("%s at position %d", fErr.message, fErr.pos)
+}
+
+//isFilterReserved reports whether the character ends an unquoted word of a filter
+func isFilterReserved(c rune) bool {
+	return strings.ContainsRune(" \t\r\n()'\";,=!<>", c)
+}
+
+//lexFilter splits the filter into tokens
+func lexFilter(filter string) ([]filterToken, error) {
+	runes := []rune(filter)
+	var tokens []filterToken
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, filterToken{filterLParen, "(", start + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{filterRParen, ")", start + 1})
+			i++
+		case c == ';':
+			tokens = append(tokens, filterToken{filterAnd, ";", start + 1})
+			i++
+		case c == ',':
+			tokens = append(tokens, filterToken{filterOr, ",", start + 1})
+			i++
+		case c == '\'' || c == '"':
+			var sb strings.Builder
+			i++
+			for i < len(runes) && runes[i] != c {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, filterError{"unterminated string", start + 1}
+			}
+			i++
+			tokens = append(tokens, filterToken{filterString, sb.String(), start + 1})
+		case c == '=':
+			i++
+			for i < len(runes) && runes[i] >= 'a' && runes[i] <= 'z' {
+				i++
+			}
+			if i >= len(runes) || runes[i] != '=' {
+				return nil, filterError{"unterminated operator", start + 1}
+			}
+			i++
+			tokens = append(tokens, filterToken{filterOperator, string(runes[start:i]), start + 1})
+		case c == '!':
+			if i+1 >= len(runes) || runes[i+1] != '=' {
+				return nil, filterError{"expected '!='", start + 1}
+			}
+			i += 2
+			tokens = append(tokens, filterToken{filterOperator, "!=", start + 1})
+		case c == '<' || c == '>':
+			i++
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+			tokens = append(tokens, filterToken{filterOperator, string(runes[start:i]), start + 1})
+		default:
+			for i < len(runes) && !isFilterReserved(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{filterWord, string(runes[start:i]), start + 1})
+		}
+	}
+	return append(tokens, filterToken{filterEOF, "", len(runes) + 1}), nil
+}
+
+//filterComparison returns an SQL comparison of an operator of a filter,
+//both FIQL and C-like operators are supported
+func filterComparison(operator string) (string, bool) {
+	switch operator {
+	case "==":
+		return "=", true
+	case "!=":
+		return "<>", true
+	case "=lt=", "<":
+		return "<", true
+	case "=le=", "<=":
+		return "<=", true
+	case "=gt=", ">":
+		return ">", true
+	case "=ge=", ">=":
+		return ">=", true
+	default:
+		return "", false
+	}
+}
+
+//filterParser compiles a filter to a condition of SQL by a recursive descent
+type filterParser struct {
+	table  TableDesc
+	tokens []filterToken
+	pos    int
+	depth  int
+	args   []interface{}
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != filterEOF {
+		p.pos++
+	}
+	return tok
+}
+
+//isKeyword reports whether the token is the word like and, or, not in any case
+func (tok filterToken) isKeyword(keyword string) bool {
+	return tok.kind == filterWord && strings.EqualFold(tok.text, keyword)
+}
+
+//parseFilter compiles the filter of rows of the table, like
+//(login==rvasily or email=like=*@example.com) and updated=isnull=true,
+//to a condition of SQL and its parameters
+func parseFilter(filter string, table TableDesc) (string, []interface{}, error) {
+	tokens, err := lexFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	p := &filterParser{table: table, tokens: tokens}
+	condition, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if tok := p.peek(); tok.kind != filterEOF {
+		return "", nil, filterError{"unexpected " + tok.String(), tok.pos}
+	}
+	return condition, p.args, nil
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	condition, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for tok := p.peek(); tok.kind == filterOr || tok.isKeyword("or"); tok = p.peek() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		condition += " OR " + right
+	}
+	return condition, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	condition, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for tok := p.peek(); tok.kind == filterAnd || tok.isKeyword("and"); tok = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		condition += " AND " + right
+	}
+	return condition, nil
+}
+
+//parseUnary parses a negation, an expression in parentheses or a comparison,
+//a column named not is compared if an operator follows it
+func (p *filterParser) parseUnary() (string, error) {
+	tok := p.peek()
+	isNot := tok.isKeyword("not") && p.tokens[p.pos+1].kind != filterOperator
+	if !isNot && tok.kind != filterLParen {
+		return p.parseComparison()
+	}
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+	if p.depth > maxFilterDepth {
+		return "", filterError{fmt.Sprintf("filter is nested deeper than %d", maxFilterDepth), tok.pos}
+	}
+	p.next()
+	if isNot {
+		condition, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + condition + ")", nil
+	}
+	condition, err := p.parseOr()
+	if err != nil {
+		return "", err
+	}
+	if closing := p.next(); closing.kind != filterRParen {
+		return "", filterError{"expected ')' instead of " + closing.String(), closing.pos}
+	}
+	return "(" + condition + ")", nil
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	selector := p.next()
+	if selector.kind != filterWord && selector.kind != filterString {
+		return "", filterError{"expected a column instead of " + selector.String(), selector.pos}
+	}
+	field, ok := p.table.fields[selector.text]
+	if !ok {
+		return "", filterError{"unknown column " + selector.text, selector.pos}
+	}
+	column := quoteIdentifier(field.Name)
+
+	operator := p.next()
+	if operator.kind != filterOperator {
+		return "", filterError{"expected an operator instead of " + operator.String(), operator.pos}
+	}
+	switch operator.text {
+	case "=in=", "=out=":
+		values, err := p.parseValues(field)
+		if err != nil {
+			return "", err
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		p.args = append(p.args, values...)
+		if operator.text == "=out=" {
+			return column + " NOT IN (" + placeholders + ")", nil
+		}
+		return column + " IN (" + placeholders + ")", nil
+	case "=like=":
+		value, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		p.args = append(p.args, strings.Replace(escapeLike(value.text), "*", "%", -1))
+		return column + " LIKE ?", nil
+	case "=isnull=":
+		value, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		isNull, err := strconv.ParseBool(value.text)
+		if err != nil {
+			return "", filterError{"expected true or false instead of " + value.String(), value.pos}
+		}
+		if isNull {
+			return column + " IS NULL", nil
+		}
+		return column + " IS NOT NULL", nil
+	}
+	comparison, ok := filterComparison(operator.text)
+	if !ok {
+		return "", filterError{"unknown operator " + operator.text, operator.pos}
+	}
+	value, err := p.parseValue(field)
+	if err != nil {
+		return "", err
+	}
+	p.args = append(p.args, value)
+	return column + " " + comparison + " ?", nil
+}
+
+//parseArgument returns a word or a string of a comparison
+func (p *filterParser) parseArgument() (filterToken, error) {
+	tok := p.next()
+	if tok.kind != filterWord && tok.kind != filterString {
+		return tok, filterError{"expected a value instead of " + tok.String(), tok.pos}
+	}
+	return tok, nil
+}
+
+//parseValue returns an argument converted to the type of the field
+func (p *filterParser) parseValue(field FieldDesc) (interface{}, error) {
+	tok, err := p.parseArgument()
+	if err != nil {
+		return nil, err
+	}
+	value, err := field.parseFormValue(tok.text)
+	if err != nil {
+		return nil, filterError{"invalid value " + tok.String() + " of column " + field.Name, tok.pos}
+	}
+	return value, nil
+}
+
+//parseValues returns a value or values in parentheses separated by commas
+func (p *filterParser) parseValues(field FieldDesc) ([]interface{}, error) {
+	if p.peek().kind != filterLParen {
+		value, err := p.parseValue(field)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+	p.next()
+	var values []interface{}
+	for {
+		value, err := p.parseValue(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		tok := p.next()
+		if tok.kind == filterRParen {
+			return values, nil
+		}
+		if tok.kind != filterOr {
+			return nil, filterError{"expected ',' or ')' instead of " + tok.String(), tok.pos}
+		}
+	}
+}
+
+//filterRespError converts an error of filter and q parameters to an error of API
+func filterRespError(err error) RespError {
+	rErr := RespError{HTTPStatus: http.StatusBadRequest, Error: err.Error()}
+	if fErr, ok := err.(filterError); ok {
+		rErr.Error = "invalid filter: " + fErr.Error()
+		rErr.Type = problemTypeInvalidFilter
+		rErr.Fields = []FieldError{{Field: "filter", Detail: fErr.Error()}}
+	}
+	return rErr
+}
+
+//filterRows adds conditions of filter and q parameters of the request to the query
+//of rows of the table, the search is returned to rank found rows
+func filterRows(query url.Values, table TableDesc, q *selectQuery) (*textSearch, error) {
+	if filter := query.Get("filter"); filter != "" {
+		condition, args, err := parseFilter(filter, table)
+		if err != nil {
+			return nil, err
+		}
+		q.where = append(q.where, "("+condition+")")
+		q.args = append(q.args, args...)
+	}
+	search, err := newTextSearch(query, table)
+	if err != nil {
+		return nil, err
+	}
+	if search != nil {
+		search.where(q)
+	}
+	return search, nil
+}
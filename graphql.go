@@ -0,0 +1,404 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+//Kinds of GraphQL types
+const (
+	gqlKindScalar      = "SCALAR"
+	gqlKindObject      = "OBJECT"
+	gqlKindInputObject = "INPUT_OBJECT"
+	gqlKindEnum        = "ENUM"
+	gqlKindList        = "LIST"
+	gqlKindNonNull     = "NON_NULL"
+)
+
+//gqlType is a type of the GraphQL schema, list and non-null types wrap ofType
+type gqlType struct {
+	kind        string
+	name        string
+	ofType      *gqlType
+	fields      []*gqlField
+	inputFields []*gqlInputValue
+	enumValues  []string
+}
+
+//gqlResolver returns a value of a field of the source object
+type gqlResolver func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error)
+
+type gqlField struct {
+	name    string
+	args    []*gqlInputValue
+	typ     *gqlType
+	resolve gqlResolver
+}
+
+//gqlInputValue is an argument of a field or a field of an input object
+type gqlInputValue struct {
+	name string
+	typ  *gqlType
+}
+
+func (t *gqlType) String() string {
+	switch t.kind {
+	case gqlKindList:
+		return "[" + t.ofType.String() + "]"
+	case gqlKindNonNull:
+		return t.ofType.String() + "!"
+	default:
+		return t.name
+	}
+}
+
+//named returns the named type wrapped by list and non-null types
+func (t *gqlType) named() *gqlType {
+	for t.ofType != nil {
+		t = t.ofType
+	}
+	return t
+}
+
+func (t *gqlType) field(name string) *gqlField {
+	for _, field := range t.fields {
+		if field.name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func (t *gqlType) isLeaf() bool {
+	named := t.named()
+	return named.kind == gqlKindScalar || named.kind == gqlKindEnum
+}
+
+func (t *gqlType) isInput() bool {
+	named := t.named()
+	return named.kind != gqlKindObject
+}
+
+func gqlNonNull(t *gqlType) *gqlType {
+	return &gqlType{kind: gqlKindNonNull, ofType: t}
+}
+
+func gqlListOf(t *gqlType) *gqlType {
+	return &gqlType{kind: gqlKindList, ofType: t}
+}
+
+func findInputValue(values []*gqlInputValue, name string) *gqlInputValue {
+	for _, value := range values {
+		if value.name == name {
+			return value
+		}
+	}
+	return nil
+}
+
+//Built-in scalars of GraphQL
+const (
+	gqlInt     = "Int"
+	gqlFloat   = "Float"
+	gqlString  = "String"
+	gqlBoolean = "Boolean"
+	gqlID      = "ID"
+)
+
+//gqlSchema is a GraphQL schema of a database, every table has an object type,
+//queries of its rows and mutations mirroring PUT, POST and DELETE
+type gqlSchema struct {
+	query    *gqlType
+	mutation *gqlType
+	//types are named types by their names
+	types map[string]*gqlType
+	//columns of tables are keyed by GraphQL names of their fields
+	columns map[string]map[string]string
+}
+
+//graphqlName makes a valid GraphQL name of a table or a column,
+//unsupported characters are replaced by underscores
+func graphqlName(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isNameStart(c) || isDigit(c) {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	result := sb.String()
+	if result == "" || isDigit(result[0]) {
+		result = "_" + result
+	}
+	return result
+}
+
+func (schema *gqlSchema) addType(t *gqlType) *gqlType {
+	schema.types[t.name] = t
+	return t
+}
+
+//fieldScalar returns a name of a scalar of values of the field
+func fieldScalar(field FieldDesc) string {
+	switch {
+	case field.Type == "int":
+		return gqlInt
+	case field.isFloat():
+		return gqlFloat
+	default:
+		return gqlString
+	}
+}
+
+//newGraphQLSchema generates a GraphQL schema of tables of desc
+func newGraphQLSchema(desc DbDesc) *gqlSchema {
+	schema := &gqlSchema{
+		query:    &gqlType{kind: gqlKindObject, name: "Query"},
+		mutation: &gqlType{kind: gqlKindObject, name: "Mutation"},
+		types:    make(map[string]*gqlType),
+		columns:  make(map[string]map[string]string),
+	}
+	schema.addType(schema.query)
+	schema.addType(schema.mutation)
+	for _, name := range []string{gqlInt, gqlFloat, gqlString, gqlBoolean, gqlID} {
+		schema.addType(&gqlType{kind: gqlKindScalar, name: name})
+	}
+
+	tableNames := make([]string, 0, len(desc.tables))
+	for name := range desc.tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+	added := make([]string, 0, len(tableNames))
+	for _, name := range tableNames {
+		if taken := schema.takenName(desc.tables[name]); taken != "" {
+			log.Printf("table %s is skipped in the GraphQL schema: name %s is already taken", name, taken)
+			continue
+		}
+		schema.addTable(desc.tables[name])
+		added = append(added, name)
+	}
+	for _, name := range added {
+		schema.addRelations(desc, desc.tables[name])
+	}
+	return schema
+}
+
+//takenName returns a name of a type or a field of the table which is already in the schema,
+//like a built-in type, a type of another table named the same after graphqlName
+//or an input type of another table, it's empty if the table can be added
+func (schema *gqlSchema) takenName(table TableDesc) string {
+	typeName := graphqlName(table.Name)
+	if strings.HasPrefix(typeName, "__") {
+		//names starting with two underscores are reserved for introspection
+		return typeName
+	}
+	for _, name := range []string{typeName, typeName + "_input", typeName + "_filter", typeName + "_sort"} {
+		if _, ok := schema.types[name]; ok {
+			return name
+		}
+	}
+	for _, name := range []string{typeName, typeName + "_by_pk"} {
+		if schema.query.field(name) != nil {
+			return name
+		}
+	}
+	for _, name := range []string{"create_" + typeName, "update_" + typeName, "delete_" + typeName} {
+		if schema.mutation.field(name) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+//addTable adds types, queries and mutations of the table
+func (schema *gqlSchema) addTable(table TableDesc) {
+	typeName := graphqlName(table.Name)
+	object := schema.addType(&gqlType{kind: gqlKindObject, name: typeName})
+	input := schema.addType(&gqlType{kind: gqlKindInputObject, name: typeName + "_input"})
+	filter := schema.addType(&gqlType{kind: gqlKindInputObject, name: typeName + "_filter"})
+	order := schema.addType(&gqlType{kind: gqlKindEnum, name: typeName + "_sort"})
+
+	columns := make(map[string]string)
+	schema.columns[table.Name] = columns
+	for _, field := range table.getFieldsArray() {
+		field := field
+		fieldName := graphqlName(field.Name)
+		columns[fieldName] = field.Name
+		scalar := schema.types[fieldScalar(field)]
+
+		fieldType := scalar
+		if !field.Nullable {
+			fieldType = gqlNonNull(scalar)
+		}
+		object.fields = append(object.fields, &gqlField{
+			name: fieldName,
+			typ:  fieldType,
+			resolve: func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(map[string]interface{})[field.Name], nil
+			},
+		})
+		if !field.IsPrimaryKey {
+			input.inputFields = append(input.inputFields, &gqlInputValue{name: fieldName, typ: scalar})
+		}
+		filter.inputFields = append(filter.inputFields, &gqlInputValue{name: fieldName, typ: scalar})
+		order.enumValues = append(order.enumValues, fieldName+"_ASC", fieldName+"_DESC")
+	}
+
+	schema.query.fields = append(schema.query.fields, &gqlField{
+		name:    typeName,
+		args:    schema.listArgs(typeName),
+		typ:     gqlNonNull(gqlListOf(gqlNonNull(object))),
+		resolve: listResolver(table, columns, nil),
+	})
+
+	keyField := table.getKeyField()
+	if keyField == nil {
+		return
+	}
+	keyName := graphqlName(keyField.Name)
+	keyArg := &gqlInputValue{name: keyName, typ: gqlNonNull(schema.types[fieldScalar(*keyField)])}
+	inputArg := &gqlInputValue{name: "input", typ: gqlNonNull(input)}
+
+	schema.query.fields = append(schema.query.fields, &gqlField{
+		name: typeName + "_by_pk",
+		args: []*gqlInputValue{keyArg},
+		typ:  object,
+		resolve: func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return ex.rowByKey(table, args[keyName])
+		},
+	})
+	if table.isReadOnly() {
+		return
+	}
+	schema.mutation.fields = append(schema.mutation.fields,
+		&gqlField{
+			name:    "create_" + typeName,
+			args:    []*gqlInputValue{inputArg},
+			typ:     object,
+			resolve: createResolver(table, columns),
+		},
+		&gqlField{
+			name:    "update_" + typeName,
+			args:    []*gqlInputValue{keyArg, inputArg},
+			typ:     object,
+			resolve: updateResolver(table, keyName, columns),
+		},
+		&gqlField{
+			name:    "delete_" + typeName,
+			args:    []*gqlInputValue{keyArg},
+			typ:     gqlNonNull(schema.types[gqlInt]),
+			resolve: deleteResolver(table, keyName),
+		},
+	)
+}
+
+//listArgs returns arguments of lists of rows of the type
+func (schema *gqlSchema) listArgs(typeName string) []*gqlInputValue {
+	return []*gqlInputValue{
+		{name: "limit", typ: schema.types[gqlInt]},
+		{name: "offset", typ: schema.types[gqlInt]},
+		{name: "filter", typ: schema.types[typeName+"_filter"]},
+		{name: "sort", typ: gqlListOf(gqlNonNull(schema.types[typeName+"_sort"]))},
+	}
+}
+
+//addRelations adds fields of related rows to the type of the table,
+//a parent is an object and children are a list with the same arguments as a query of them
+func (schema *gqlSchema) addRelations(desc DbDesc, table TableDesc) {
+	object := schema.types[graphqlName(table.Name)]
+	for _, rel := range table.relations {
+		rel := rel
+		related := desc.tables[rel.table]
+		if _, ok := schema.columns[related.Name]; !ok {
+			//the related table is skipped in the schema
+			continue
+		}
+		relatedName := graphqlName(related.Name)
+		field := &gqlField{name: graphqlName(rel.name)}
+		if object.field(field.name) != nil {
+			continue
+		}
+		if rel.toParent {
+			field.typ = schema.types[relatedName]
+			field.resolve = func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+				rows, err := ex.relatedRows(rel, related, source, newSelectQuery(related.Name))
+				if err != nil {
+					return nil, err
+				}
+				if len(rows) == 0 {
+					return nil, nil
+				}
+				return rows[0], nil
+			}
+		} else {
+			field.args = schema.listArgs(relatedName)
+			field.typ = gqlNonNull(gqlListOf(gqlNonNull(schema.types[relatedName])))
+			field.resolve = listResolver(related, schema.columns[related.Name], &rel)
+		}
+		object.fields = append(object.fields, field)
+	}
+}
+
+//columnParams converts an input object keyed by GraphQL names to params keyed by columns
+func columnParams(input interface{}, columns map[string]string) map[string]interface{} {
+	params := make(map[string]interface{})
+	if fields, ok := input.(map[string]interface{}); ok {
+		for name, value := range fields {
+			params[columns[name]] = value
+		}
+	}
+	return params
+}
+
+//printSchema returns the schema in the GraphQL schema definition language
+func (schema *gqlSchema) printSchema() string {
+	names := make([]string, 0, len(schema.types))
+	for name, t := range schema.types {
+		if t.kind != gqlKindScalar && t != schema.query && t != schema.mutation {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	printType := func(t *gqlType) {
+		switch t.kind {
+		case gqlKindObject:
+			sb.WriteString("type " + t.name + " {\n")
+			for _, field := range t.fields {
+				sb.WriteString("  " + field.name)
+				if len(field.args) > 0 {
+					args := make([]string, len(field.args))
+					for i, arg := range field.args {
+						args[i] = arg.name + ": " + arg.typ.String()
+					}
+					sb.WriteString("(" + strings.Join(args, ", ") + ")")
+				}
+				sb.WriteString(": " + field.typ.String() + "\n")
+			}
+		case gqlKindInputObject:
+			sb.WriteString("input " + t.name + " {\n")
+			for _, field := range t.inputFields {
+				sb.WriteString("  " + field.name + ": " + field.typ.String() + "\n")
+			}
+		case gqlKindEnum:
+			sb.WriteString("enum " + t.name + " {\n")
+			for _, value := range t.enumValues {
+				sb.WriteString("  " + value + "\n")
+			}
+		}
+		sb.WriteString("}\n\n")
+	}
+	printType(schema.query)
+	if len(schema.mutation.fields) > 0 {
+		printType(schema.mutation)
+	}
+	for _, name := range names {
+		printType(schema.types[name])
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
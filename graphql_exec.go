@@ -0,0 +1,999 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const contentTypeGraphQL = "application/graphql"
+
+//gqlMaxDepth is a maximum number of levels of nested selections of an operation
+const gqlMaxDepth = 8
+
+//gqlRequest is a body of a GraphQL request
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+//gqlExecution is a state of an execution of an operation
+type gqlExecution struct {
+	ctx       context.Context
+	l         *Router
+	schema    *gqlSchema
+	doc       *gqlDocument
+	variables map[string]interface{}
+	errors    []gqlError
+	//path is a path of the field being resolved
+	path []interface{}
+	//levels are objects of every level of selections like users.items,
+	//relations of them are read by a single query per level
+	levels map[string][]map[string]interface{}
+	//batches are related rows read for levels of relation fields
+	batches map[string]*gqlBatch
+}
+
+//gqlBatch is rows related to objects of a level grouped by keys of their columns of the relation
+type gqlBatch struct {
+	//seen are keys of the objects the related rows are read for
+	seen    map[string]bool
+	grouped map[string][]interface{}
+	err     error
+}
+
+//MarshalJSON encodes the object as a JSON object keeping the order of its members,
+//GraphQL responses follow the order of selections
+func (obj plainObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, field := range obj {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, key...), ':'), value...)
+	}
+	return append(buf, '}'), nil
+}
+
+//serveGraphQL executes a GraphQL request, GET requests without a query
+//are answered with the schema in the schema definition language
+func serveGraphQL(w http.ResponseWriter, r *http.Request, l *Router) {
+	var req gqlRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if req.Query == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, err := w.Write([]byte(l.graphql.printSchema()))
+			if err != nil {
+				log.Println("can't serve:" + err.Error())
+			}
+			return
+		}
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				RespError{HTTPStatus: http.StatusBadRequest, Error: "can't parse variables"}.serve(w, r, l)
+				return
+			}
+		}
+	} else {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case contentTypeJSON, "":
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				RespError{HTTPStatus: http.StatusBadRequest, Error: "can't parse a body"}.serve(w, r, l)
+				return
+			}
+		case contentTypeGraphQL:
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				RespError{HTTPStatus: http.StatusBadRequest, Error: "can't parse a body"}.serve(w, r, l)
+				return
+			}
+			req.Query = string(data)
+		default:
+			bodyError(unsupportedContentTypeError{r.Header.Get("Content-Type")}).serve(w, r, l)
+			return
+		}
+	}
+
+	ctx, cancel := l.requestContext(r, RouteGraphQL)
+	defer cancel()
+	ex := &gqlExecution{
+		ctx:     ctx,
+		l:       l,
+		schema:  l.graphql,
+		levels:  make(map[string][]map[string]interface{}),
+		batches: make(map[string]*gqlBatch),
+	}
+	data, status := ex.execute(req, r.Method == http.MethodGet)
+
+	resp := plainObject{}
+	if len(ex.errors) > 0 {
+		resp = append(resp, plainField{"errors", ex.errors})
+	}
+	if status == http.StatusOK {
+		resp = append(resp, plainField{"data", data})
+	}
+	if status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	serveRepresentation(w, contentTypeJSON, status, resp)
+}
+
+//execute runs the operation of the request and returns its data with a status of the answer,
+//request errors like syntax errors stop the request before any execution.
+//Mutations aren't run for GET requests
+func (ex *gqlExecution) execute(req gqlRequest, readOnly bool) (interface{}, int) {
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		ex.addError(err)
+		return nil, http.StatusBadRequest
+	}
+	ex.doc = doc
+
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		ex.addError(err)
+		return nil, http.StatusBadRequest
+	}
+	var root *gqlType
+	switch op.kind {
+	case "query":
+		root = ex.schema.query
+	case "mutation":
+		if readOnly {
+			ex.addError(newGQLError(op.loc, "Can only perform a mutation operation from a POST request."))
+			return nil, http.StatusMethodNotAllowed
+		}
+		root = ex.schema.mutation
+		if len(root.fields) == 0 {
+			ex.addError(newGQLError(op.loc, "Schema is not configured for mutations."))
+			return nil, http.StatusBadRequest
+		}
+	default:
+		ex.addError(newGQLError(op.loc, "Schema is not configured for %ss.", op.kind))
+		return nil, http.StatusBadRequest
+	}
+
+	ex.variables, err = ex.coerceVariables(op, req.Variables)
+	if err == nil {
+		err = ex.validateSelections(root, op.selections, make(map[string]bool), 1)
+	}
+	if err != nil {
+		ex.addError(err)
+		return nil, http.StatusBadRequest
+	}
+
+	data, _ := ex.executeSelections(root, nil, op.selections, []interface{}{})
+	return data, http.StatusOK
+}
+
+func (ex *gqlExecution) addError(err error) {
+	var gErr gqlError
+	if !errors.As(err, &gErr) {
+		gErr = gqlError{Message: err.Error()}
+	}
+	ex.errors = append(ex.errors, gErr)
+}
+
+//operation returns the operation to run, a name is required when there are many of them
+func (doc *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, gqlError{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, gqlError{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+//resolveTypeRef returns a type of the schema for a type of a variable definition
+func (ex *gqlExecution) resolveTypeRef(ref *gqlTypeRef) *gqlType {
+	var t *gqlType
+	if ref.list != nil {
+		ofType := ex.resolveTypeRef(ref.list)
+		if ofType == nil {
+			return nil
+		}
+		t = gqlListOf(ofType)
+	} else if t = ex.schema.types[ref.name]; t == nil {
+		return nil
+	}
+	if ref.nonNull {
+		t = gqlNonNull(t)
+	}
+	return t
+}
+
+//coerceVariables checks values of variables of the operation against their types,
+//defaults are used for missing values
+func (ex *gqlExecution) coerceVariables(op *gqlOperation, values map[string]interface{}) (map[string]interface{}, error) {
+	coerced := make(map[string]interface{})
+	varTypes := make(map[string]*gqlType)
+	for _, def := range op.variables {
+		t := ex.resolveTypeRef(def.typ)
+		if t == nil || !t.isInput() {
+			return nil, newGQLError(def.loc, "Variable \"$%s\" cannot be non-input type %q.", def.name, def.typ)
+		}
+		varTypes[def.name] = t
+		value, ok := values[def.name]
+		if !ok {
+			if def.defaultValue != nil {
+				defaultValue, err := ex.coerceLiteral(def.defaultValue, t, nil)
+				if err != nil {
+					return nil, err
+				}
+				coerced[def.name] = defaultValue
+			} else if t.kind == gqlKindNonNull {
+				return nil, newGQLError(def.loc, "Variable \"$%s\" of required type %q was not provided.", def.name, def.typ)
+			}
+			continue
+		}
+		converted, err := coerceVariableValue(value, t)
+		if err != nil {
+			return nil, newGQLError(def.loc, "Variable \"$%s\" got invalid value: %s", def.name, err.Error())
+		}
+		coerced[def.name] = converted
+	}
+	return coerced, ex.checkVariableUsages(op.selections, varTypes, make(map[string]bool))
+}
+
+//checkVariableUsages checks that variables used by arguments are defined by the operation
+func (ex *gqlExecution) checkVariableUsages(selections []*gqlSelection, varTypes map[string]*gqlType, visited map[string]bool) error {
+	var checkValue func(value *gqlValue) error
+	checkValue = func(value *gqlValue) error {
+		switch value.kind {
+		case gqlValueVariable:
+			if _, ok := varTypes[value.raw]; !ok {
+				return newGQLError(value.loc, "Variable \"$%s\" is not defined.", value.raw)
+			}
+		case gqlValueList:
+			for _, item := range value.list {
+				if err := checkValue(item); err != nil {
+					return err
+				}
+			}
+		case gqlValueObject:
+			for _, field := range value.fields {
+				if err := checkValue(field.value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	checkArgs := func(args []gqlArgument) error {
+		for _, arg := range args {
+			if err := checkValue(arg.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, sel := range selections {
+		if err := checkArgs(sel.args); err != nil {
+			return err
+		}
+		for _, directive := range sel.directives {
+			if err := checkArgs(directive.args); err != nil {
+				return err
+			}
+		}
+		subSelections := sel.selections
+		if sel.kind == gqlSelectFragmentSpread {
+			fragment, ok := ex.doc.fragments[sel.name]
+			if !ok || visited[sel.name] {
+				continue
+			}
+			visited[sel.name] = true
+			subSelections = fragment.selections
+		}
+		if err := ex.checkVariableUsages(subSelections, varTypes, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//coerceVariableValue converts a JSON value of a variable to the input type
+func coerceVariableValue(value interface{}, t *gqlType) (interface{}, error) {
+	if t.kind == gqlKindNonNull {
+		if value == nil {
+			return nil, fmt.Errorf("Expected non-nullable type %q not to be null.", t)
+		}
+		return coerceVariableValue(value, t.ofType)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	switch t.kind {
+	case gqlKindList:
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if coerced[i], err = coerceVariableValue(item, t.ofType); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	case gqlKindInputObject:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected type %q to be an object.", t.name)
+		}
+		coerced := make(map[string]interface{})
+		for name, fieldValue := range fields {
+			inputField := findInputValue(t.inputFields, name)
+			if inputField == nil {
+				return nil, fmt.Errorf("Field %q is not defined by type %q.", name, t.name)
+			}
+			converted, err := coerceVariableValue(fieldValue, inputField.typ)
+			if err != nil {
+				return nil, err
+			}
+			coerced[name] = converted
+		}
+		return coerced, checkRequiredFields(t, coerced)
+	case gqlKindEnum:
+		if name, ok := value.(string); ok && isEnumValue(t, name) {
+			return name, nil
+		}
+	default:
+		if coerced, ok := coerceScalar(t.name, value); ok {
+			return coerced, nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot represent value: %s", t.name, jsonString(value))
+}
+
+//coerceScalar converts a JSON value to the scalar
+func coerceScalar(scalar string, value interface{}) (interface{}, bool) {
+	switch scalar {
+	case gqlInt:
+		if number, ok := value.(float64); ok && number == math.Trunc(number) && math.Abs(number) <= math.MaxInt32 {
+			return int(number), true
+		}
+	case gqlFloat:
+		if number, ok := value.(float64); ok {
+			return number, true
+		}
+	case gqlString:
+		if s, ok := value.(string); ok {
+			return s, true
+		}
+	case gqlID:
+		switch casted := value.(type) {
+		case string:
+			return casted, true
+		case float64:
+			if casted == math.Trunc(casted) {
+				return strconv.FormatFloat(casted, 'f', -1, 64), true
+			}
+		}
+	case gqlBoolean:
+		if b, ok := value.(bool); ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func jsonString(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func isEnumValue(t *gqlType, name string) bool {
+	for _, value := range t.enumValues {
+		if value == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRequiredFields(t *gqlType, fields map[string]interface{}) error {
+	for _, inputField := range t.inputFields {
+		if _, ok := fields[inputField.name]; !ok && inputField.typ.kind == gqlKindNonNull {
+			return fmt.Errorf("Field %q of required type %q was not provided.", inputField.name, inputField.typ)
+		}
+	}
+	return nil
+}
+
+//coerceLiteral converts a value of the document to the input type,
+//variables are taken from vars
+func (ex *gqlExecution) coerceLiteral(value *gqlValue, t *gqlType, vars map[string]interface{}) (interface{}, error) {
+	if value.kind == gqlValueVariable {
+		varValue, ok := vars[value.raw]
+		if (!ok || varValue == nil) && t.kind == gqlKindNonNull {
+			return nil, newGQLError(value.loc, "Variable \"$%s\" of type %q used in position expecting %q must not be null.", value.raw, t.ofType, t)
+		}
+		return varValue, nil
+	}
+	if t.kind == gqlKindNonNull {
+		if value.kind == gqlValueNull {
+			return nil, newGQLError(value.loc, "Expected value of type %q, found null.", t)
+		}
+		return ex.coerceLiteral(value, t.ofType, vars)
+	}
+	if value.kind == gqlValueNull {
+		return nil, nil
+	}
+
+	invalid := newGQLError(value.loc, "%s cannot represent value: %s", t, value.raw)
+	switch t.kind {
+	case gqlKindList:
+		items := value.list
+		if value.kind != gqlValueList {
+			items = []*gqlValue{value}
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if coerced[i], err = ex.coerceLiteral(item, t.ofType, vars); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	case gqlKindInputObject:
+		if value.kind != gqlValueObject {
+			return nil, newGQLError(value.loc, "Expected value of type %q, found %s.", t, value.raw)
+		}
+		coerced := make(map[string]interface{})
+		for _, field := range value.fields {
+			inputField := findInputValue(t.inputFields, field.name)
+			if inputField == nil {
+				return nil, newGQLError(field.loc, "Field %q is not defined by type %q.", field.name, t.name)
+			}
+			if _, ok := coerced[field.name]; ok {
+				return nil, newGQLError(field.loc, "There can be only one input field named %q.", field.name)
+			}
+			if field.value.kind == gqlValueVariable {
+				if _, ok := vars[field.value.raw]; !ok {
+					continue
+				}
+			}
+			converted, err := ex.coerceLiteral(field.value, inputField.typ, vars)
+			if err != nil {
+				return nil, err
+			}
+			coerced[field.name] = converted
+		}
+		if err := checkRequiredFields(t, coerced); err != nil {
+			return nil, newGQLError(value.loc, "%s", err.Error())
+		}
+		return coerced, nil
+	case gqlKindEnum:
+		if value.kind == gqlValueEnum && isEnumValue(t, value.raw) {
+			return value.raw, nil
+		}
+		return nil, newGQLError(value.loc, "Value %q does not exist in %q enum.", value.raw, t.name)
+	}
+
+	switch {
+	case t.name == gqlInt && value.kind == gqlValueInt:
+		number, err := strconv.ParseInt(value.raw, 10, 32)
+		if err != nil {
+			return nil, newGQLError(value.loc, "Int cannot represent non 32-bit signed integer value: %s", value.raw)
+		}
+		return int(number), nil
+	case t.name == gqlFloat && (value.kind == gqlValueInt || value.kind == gqlValueFloat):
+		number, err := strconv.ParseFloat(value.raw, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return number, nil
+	case t.name == gqlString && value.kind == gqlValueString:
+		return value.raw, nil
+	case t.name == gqlID && (value.kind == gqlValueString || value.kind == gqlValueInt):
+		return value.raw, nil
+	case t.name == gqlBoolean && value.kind == gqlValueBoolean:
+		return value.raw == "true", nil
+	}
+	if value.kind == gqlValueString {
+		invalid.Message = fmt.Sprintf("%s cannot represent value: %q", t, value.raw)
+	}
+	return nil, invalid
+}
+
+//coerceArguments returns values of arguments of the field, missing arguments
+//and ones set by missing variables are absent in the result
+func (ex *gqlExecution) coerceArguments(defs []*gqlInputValue, args []gqlArgument, loc gqlLocation, owner string) (map[string]interface{}, error) {
+	coerced := make(map[string]interface{})
+	for _, arg := range args {
+		def := findInputValue(defs, arg.name)
+		if def == nil {
+			return nil, newGQLError(arg.loc, "Unknown argument %q on %s.", arg.name, owner)
+		}
+		if _, ok := coerced[arg.name]; ok {
+			return nil, newGQLError(arg.loc, "There can be only one argument named %q.", arg.name)
+		}
+		if arg.value.kind == gqlValueVariable {
+			if _, ok := ex.variables[arg.value.raw]; !ok && def.typ.kind != gqlKindNonNull {
+				continue
+			}
+		}
+		value, err := ex.coerceLiteral(arg.value, def.typ, ex.variables)
+		if err != nil {
+			return nil, err
+		}
+		coerced[arg.name] = value
+	}
+	for _, def := range defs {
+		if _, ok := coerced[def.name]; !ok && def.typ.kind == gqlKindNonNull {
+			return nil, newGQLError(loc, "%s argument %q of type %q is required, but it was not provided.", owner, def.name, def.typ)
+		}
+	}
+	return coerced, nil
+}
+
+//validateSelections checks selections at the depth against the type before anything is executed,
+//so an invalid request doesn't run a part of its mutations
+func (ex *gqlExecution) validateSelections(t *gqlType, selections []*gqlSelection, spreading map[string]bool, depth int) error {
+	for _, sel := range selections {
+		if _, err := ex.isIncluded(sel); err != nil {
+			return err
+		}
+		switch sel.kind {
+		case gqlSelectFragmentSpread:
+			fragment, ok := ex.doc.fragments[sel.name]
+			if !ok {
+				return newGQLError(sel.loc, "Unknown fragment %q.", sel.name)
+			}
+			if spreading[sel.name] {
+				return newGQLError(sel.loc, "Cannot spread fragment %q within itself.", sel.name)
+			}
+			if fragment.typeCondition != t.name {
+				return newGQLError(sel.loc, "Fragment %q cannot be spread here as objects of type %q can never be of type %q.", sel.name, t.name, fragment.typeCondition)
+			}
+			spreading[sel.name] = true
+			err := ex.validateSelections(t, fragment.selections, spreading, depth)
+			delete(spreading, sel.name)
+			if err != nil {
+				return err
+			}
+		case gqlSelectInlineFragment:
+			if sel.typeCondition != "" && sel.typeCondition != t.name {
+				return newGQLError(sel.loc, "Fragment cannot be spread here as objects of type %q can never be of type %q.", t.name, sel.typeCondition)
+			}
+			if err := ex.validateSelections(t, sel.selections, spreading, depth); err != nil {
+				return err
+			}
+		default:
+			if sel.name == "__typename" {
+				if len(sel.selections) > 0 {
+					return newGQLError(sel.loc, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields.")
+				}
+				continue
+			}
+			field := t.field(sel.name)
+			if field == nil {
+				return newGQLError(sel.loc, "Cannot query field %q on type %q.", sel.name, t.name)
+			}
+			if _, err := ex.coerceArguments(field.args, sel.args, sel.loc, "Field \""+t.name+"."+field.name+"\""); err != nil {
+				return err
+			}
+			if field.typ.isLeaf() {
+				if len(sel.selections) > 0 {
+					return newGQLError(sel.loc, "Field %q must not have a selection since type %q has no subfields.", sel.name, field.typ)
+				}
+				continue
+			}
+			if len(sel.selections) == 0 {
+				return newGQLError(sel.loc, "Field %q of type %q must have a selection of subfields.", sel.name, field.typ)
+			}
+			if depth >= gqlMaxDepth {
+				return newGQLError(sel.loc, "Field %q exceeds the maximum depth of %d levels of selections.", sel.name, gqlMaxDepth)
+			}
+			if err := ex.validateSelections(field.typ.named(), sel.selections, spreading, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//isIncluded applies the @skip and @include directives of the selection
+func (ex *gqlExecution) isIncluded(sel *gqlSelection) (bool, error) {
+	ifArg := []*gqlInputValue{{name: "if", typ: gqlNonNull(ex.schema.types[gqlBoolean])}}
+	for _, directive := range sel.directives {
+		if directive.name != "skip" && directive.name != "include" {
+			return false, newGQLError(directive.loc, "Unknown directive \"@%s\".", directive.name)
+		}
+		args, err := ex.coerceArguments(ifArg, directive.args, directive.loc, "Directive \"@"+directive.name+"\"")
+		if err != nil {
+			return false, err
+		}
+		if args["if"].(bool) == (directive.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+//collectFields groups fields of selections by their response keys in the order of selections,
+//fragments are expanded
+func (ex *gqlExecution) collectFields(selections []*gqlSelection, keys *[]string, fields map[string][]*gqlSelection, visited map[string]bool) {
+	for _, sel := range selections {
+		if included, _ := ex.isIncluded(sel); !included {
+			continue
+		}
+		switch sel.kind {
+		case gqlSelectFragmentSpread:
+			if visited[sel.name] {
+				continue
+			}
+			visited[sel.name] = true
+			ex.collectFields(ex.doc.fragments[sel.name].selections, keys, fields, visited)
+		case gqlSelectInlineFragment:
+			ex.collectFields(sel.selections, keys, fields, visited)
+		default:
+			key := sel.responseKey()
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], sel)
+		}
+	}
+}
+
+//executeSelections resolves fields of the object, false is returned
+//if a non-null field is null so the object is null as well
+func (ex *gqlExecution) executeSelections(t *gqlType, source interface{}, selections []*gqlSelection, path []interface{}) (interface{}, bool) {
+	keys := make([]string, 0)
+	fields := make(map[string][]*gqlSelection)
+	ex.collectFields(selections, &keys, fields, make(map[string]bool))
+
+	result := make(plainObject, 0, len(keys))
+	for _, key := range keys {
+		sels := fields[key]
+		sel := sels[0]
+		fieldPath := append(append([]interface{}{}, path...), key)
+		if sel.name == "__typename" {
+			result = append(result, plainField{key, t.name})
+			continue
+		}
+		field := t.field(sel.name)
+		args, _ := ex.coerceArguments(field.args, sel.args, sel.loc, field.name)
+
+		var subSelections []*gqlSelection
+		for _, s := range sels {
+			subSelections = append(subSelections, s.selections...)
+		}
+
+		ex.path = fieldPath
+		value, err := field.resolve(ex, source, args)
+		if err != nil {
+			var gErr gqlError
+			if !errors.As(err, &gErr) {
+				gErr = gqlError{Message: err.Error()}
+			}
+			gErr.Locations = []gqlLocation{sel.loc}
+			gErr.Path = fieldPath
+			ex.errors = append(ex.errors, gErr)
+			value = nil
+		}
+		completed, ok := ex.completeValue(field.typ, subSelections, value, fieldPath, sel.loc, err != nil)
+		if !ok {
+			if field.typ.kind == gqlKindNonNull {
+				return nil, false
+			}
+			completed = nil
+		}
+		result = append(result, plainField{key, completed})
+	}
+	return result, true
+}
+
+//completeValue shapes the resolved value by the type, false is returned when the value
+//is null because of an error which is reported already, it makes the nearest nullable
+//parent null. failed means that the resolver of the value has failed
+func (ex *gqlExecution) completeValue(t *gqlType, selections []*gqlSelection, value interface{}, path []interface{}, loc gqlLocation, failed bool) (interface{}, bool) {
+	if t.kind == gqlKindNonNull {
+		completed, ok := ex.completeValue(t.ofType, selections, value, path, loc, failed)
+		if !ok {
+			return nil, false
+		}
+		if completed == nil {
+			ex.errors = append(ex.errors, gqlError{
+				Message:   fmt.Sprintf("Cannot return null for non-nullable field %s.", path[len(path)-1]),
+				Locations: []gqlLocation{loc},
+				Path:      path,
+			})
+			return nil, false
+		}
+		return completed, true
+	}
+	if value == nil {
+		return nil, !failed
+	}
+	switch t.kind {
+	case gqlKindList:
+		var items []interface{}
+		switch casted := value.(type) {
+		case []interface{}:
+			items = casted
+		case []map[string]interface{}:
+			items = make([]interface{}, len(casted))
+			for i, item := range casted {
+				items[i] = item
+			}
+		}
+		ex.addLevel(path, items)
+		completed := make([]interface{}, len(items))
+		for i, item := range items {
+			itemPath := append(append([]interface{}{}, path...), i)
+			var ok bool
+			if completed[i], ok = ex.completeValue(t.ofType, selections, item, itemPath, loc, false); !ok {
+				if t.ofType.kind == gqlKindNonNull {
+					return nil, false
+				}
+				completed[i] = nil
+			}
+		}
+		return completed, true
+	case gqlKindObject:
+		ex.addLevel(path, []interface{}{value})
+		return ex.executeSelections(t, value, selections, path)
+	default:
+		return serializeScalar(t.name, value), true
+	}
+}
+
+//serializeScalar converts a decoded value of a column to the scalar,
+//values of float columns are decoded as strings
+func serializeScalar(scalar string, value interface{}) interface{} {
+	switch scalar {
+	case gqlFloat:
+		if s, ok := value.(string); ok {
+			if number, err := strconv.ParseFloat(s, 64); err == nil {
+				return number
+			}
+		}
+	case gqlString, gqlID:
+		if _, ok := value.(string); !ok {
+			return fmt.Sprint(value)
+		}
+	}
+	return value
+}
+
+//resolverError converts errors of the database and validation to GraphQL errors,
+//the HTTP status of the matching REST answer is kept in extensions
+func resolverError(rErr RespError) error {
+	return gqlError{Message: rErr.Error, Extensions: map[string]interface{}{"status": rErr.HTTPStatus}}
+}
+
+//listResolver returns rows of the table chosen by filter, sort, limit and offset arguments,
+//the limit has the same default and cap as GET /$table. Rows are related to the source row
+//if rel isn't nil, then the limit and the offset apply to rows of every source row
+func listResolver(table TableDesc, columns map[string]string, rel *relation) gqlResolver {
+	return func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+		q := newSelectQuery(table.Name)
+		filter := columnParams(args["filter"], columns)
+		filterColumns := make([]string, 0, len(filter))
+		for column := range filter {
+			filterColumns = append(filterColumns, column)
+		}
+		sort.Strings(filterColumns)
+		for _, column := range filterColumns {
+			q.whereEquals(column, filter[column])
+		}
+		if orders, ok := args["sort"].([]interface{}); ok {
+			for _, order := range orders {
+				name := order.(string)
+				descending := strings.HasSuffix(name, "_DESC")
+				name = strings.TrimSuffix(strings.TrimSuffix(name, "_DESC"), "_ASC")
+				q.addOrder(columns[name], descending)
+			}
+		}
+
+		q.limit = defaultLimit
+		if limit, ok := args["limit"].(int); ok {
+			q.limit = limit
+		}
+		if maxLimit := ex.l.maxLimit; maxLimit > 0 && (q.limit > maxLimit || q.limit < 0) {
+			q.limit = maxLimit
+		}
+		if offset, ok := args["offset"].(int); ok {
+			if offset < 0 {
+				return nil, resolverError(RespError{HTTPStatus: http.StatusBadRequest, Error: "offset must not be negative"})
+			}
+			q.offset = offset
+		}
+
+		if rel != nil {
+			_, to := rel.relationColumns()
+			q.limitPerGroup(table, to)
+			return ex.relatedRows(*rel, table, source, q)
+		}
+		rows, err := queryRows(ex.ctx, ex.l.db, table, q)
+		if err != nil {
+			log.Println(err)
+			return nil, resolverError(dbError(err))
+		}
+		return rows, nil
+	}
+}
+
+//levelKey returns a path of a field without positions in lists, like users.items
+func levelKey(path []interface{}) string {
+	var names []string
+	for _, elem := range path {
+		if name, ok := elem.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ".")
+}
+
+//addLevel keeps row objects of the level of the path unless the level is known already
+func (ex *gqlExecution) addLevel(path []interface{}, objects []interface{}) {
+	level := levelKey(path)
+	if _, ok := ex.levels[level]; ok {
+		return
+	}
+	rows := make([]map[string]interface{}, 0, len(objects))
+	for _, object := range objects {
+		if row, ok := object.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+	ex.levels[level] = rows
+}
+
+//relatedRows returns rows related by the relation to the source row selected by q.
+//They are read at once for all objects of the level of the source row,
+//so every level of relations costs a single query
+func (ex *gqlExecution) relatedRows(rel relation, related TableDesc, source interface{}, q *selectQuery) ([]interface{}, error) {
+	row := source.(map[string]interface{})
+	from, _ := rel.relationColumns()
+	key, _, ok := tupleKey(row, from)
+	if !ok {
+		return []interface{}{}, nil
+	}
+	level := levelKey(ex.path)
+	batch, ok := ex.batches[level]
+	if !ok {
+		batch = &gqlBatch{seen: make(map[string]bool), grouped: make(map[string][]interface{})}
+		ex.batches[level] = batch
+	}
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	if !batch.seen[key] {
+		sourceLevel := ex.levels[levelKey(ex.path[:len(ex.path)-1])]
+		objects := append(append(make([]map[string]interface{}, 0, len(sourceLevel)+1), sourceLevel...), row)
+		var pending []map[string]interface{}
+		for _, object := range objects {
+			if objectKey, _, ok := tupleKey(object, from); ok && !batch.seen[objectKey] {
+				batch.seen[objectKey] = true
+				pending = append(pending, object)
+			}
+		}
+		grouped, err := queryRelated(ex.ctx, ex.l.db, related, rel, pending, q)
+		if err != nil {
+			log.Println(err)
+			batch.err = resolverError(dbError(err))
+			return nil, batch.err
+		}
+		relatedLevel := ex.levels[level]
+		for groupKey, rows := range grouped {
+			batch.grouped[groupKey] = rows
+			for _, relatedRow := range rows {
+				relatedLevel = append(relatedLevel, relatedRow.(map[string]interface{}))
+			}
+		}
+		ex.levels[level] = relatedLevel
+	}
+	rows := batch.grouped[key]
+	if rows == nil {
+		rows = []interface{}{}
+	}
+	return rows, nil
+}
+
+//rowByKey returns a row of the table with the key, nil is returned if there is no such row
+func (ex *gqlExecution) rowByKey(table TableDesc, key interface{}) (interface{}, error) {
+	q := newSelectQuery(table.Name)
+	q.whereEquals(table.getKeyField().Name, key)
+	rows, err := queryRows(ex.ctx, ex.l.db, table, q)
+	if err != nil {
+		log.Println(err)
+		return nil, resolverError(dbError(err))
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+//createResolver inserts a row like PUT /$table and returns it
+func createResolver(table TableDesc, columns map[string]string) gqlResolver {
+	return func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+		values := table.prepInsertValues(columnParams(args["input"], columns))
+		res, err := ex.l.db.ExecContext(ex.ctx, table.prepInsertSqlQuery(), values...)
+		if err != nil {
+			log.Println("db.Exec with err:", err, " passed values:", values)
+			return nil, resolverError(dbError(err))
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			log.Println("LastInsertId err:", err)
+			return nil, resolverError(RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"})
+		}
+		return ex.rowByKey(table, id)
+	}
+}
+
+//updateResolver updates a row like POST /$table/$id and returns it,
+//null is returned if there is no row with the key
+func updateResolver(table TableDesc, keyName string, columns map[string]string) gqlResolver {
+	return func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+		params := columnParams(args["input"], columns)
+		fieldNames, err := table.updateFields(params)
+		if err != nil {
+			return nil, resolverError(bodyError(err))
+		}
+		if len(fieldNames) > 0 {
+			values := make([]interface{}, 0, len(fieldNames)+1)
+			for _, name := range fieldNames {
+				values = append(values, params[name])
+			}
+			values = append(values, args[keyName])
+			_, err = ex.l.db.ExecContext(ex.ctx, prepareUpdateQuery(table.Name, table.getKeyField().Name, fieldNames), values...)
+			if err != nil {
+				log.Println("err db.Exec:", err)
+				return nil, resolverError(dbError(err))
+			}
+		}
+		return ex.rowByKey(table, args[keyName])
+	}
+}
+
+//deleteResolver deletes a row like DELETE /$table/$id and returns a number of deleted rows
+func deleteResolver(table TableDesc, keyName string) gqlResolver {
+	return func(ex *gqlExecution, source interface{}, args map[string]interface{}) (interface{}, error) {
+		sqlQuery := fmt.Sprintf("delete from %s where %s = ?", table.Name, table.getKeyField().Name)
+		res, err := ex.l.db.ExecContext(ex.ctx, sqlQuery, args[keyName])
+		if err != nil {
+			log.Println("err db.Exec:", err)
+			return nil, resolverError(dbError(err))
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return nil, resolverError(RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"})
+		}
+		return deleted, nil
+	}
+}
@@ -0,0 +1,802 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//gqlLocation is a position in a GraphQL document, lines and columns start from 1
+type gqlLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+//gqlError is an error of a GraphQL request in the form of the response "errors" list
+type gqlError struct {
+	Message    string                 `json:"message"`
+	Locations  []gqlLocation          `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (gErr gqlError) Error() string {
+	return gErr.Message
+}
+
+func newGQLError(loc gqlLocation, format string, args ...interface{}) gqlError {
+	return gqlError{Message: fmt.Sprintf(format, args...), Locations: []gqlLocation{loc}}
+}
+
+//Kinds of tokens of GraphQL documents
+const (
+	gqlTokenEOF = iota
+	gqlTokenPunct
+	gqlTokenName
+	gqlTokenInt
+	gqlTokenFloat
+	gqlTokenString
+)
+
+type gqlToken struct {
+	kind  int
+	value string
+	loc   gqlLocation
+}
+
+func (tok gqlToken) String() string {
+	switch tok.kind {
+	case gqlTokenEOF:
+		return "<EOF>"
+	case gqlTokenString:
+		return strconv.Quote(tok.value)
+	default:
+		return tok.value
+	}
+}
+
+//gqlLexer splits a GraphQL document into tokens, commas and comments are skipped
+type gqlLexer struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+}
+
+func (lex *gqlLexer) location() gqlLocation {
+	return gqlLocation{Line: lex.line, Column: utf8.RuneCountInString(lex.src[lex.lineStart:lex.pos]) + 1}
+}
+
+func (lex *gqlLexer) newLine(pos int) {
+	lex.line++
+	lex.lineStart = pos
+}
+
+func (lex *gqlLexer) skipIgnored() {
+	for lex.pos < len(lex.src) {
+		switch c := lex.src[lex.pos]; c {
+		case ' ', '\t', ',':
+			lex.pos++
+		case '\n':
+			lex.pos++
+			lex.newLine(lex.pos)
+		case '\r':
+			lex.pos++
+			if lex.pos < len(lex.src) && lex.src[lex.pos] == '\n' {
+				lex.pos++
+			}
+			lex.newLine(lex.pos)
+		case '#':
+			for lex.pos < len(lex.src) && lex.src[lex.pos] != '\n' && lex.src[lex.pos] != '\r' {
+				lex.pos++
+			}
+		default:
+			//a byte order mark is ignored like a space
+			if strings.HasPrefix(lex.src[lex.pos:], "\uFEFF") {
+				lex.pos += len("\uFEFF")
+				continue
+			}
+			return
+		}
+	}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (lex *gqlLexer) next() (gqlToken, error) {
+	lex.skipIgnored()
+	loc := lex.location()
+	if lex.pos >= len(lex.src) {
+		return gqlToken{kind: gqlTokenEOF, loc: loc}, nil
+	}
+	c := lex.src[lex.pos]
+	switch {
+	case strings.HasPrefix(lex.src[lex.pos:], "..."):
+		lex.pos += 3
+		return gqlToken{kind: gqlTokenPunct, value: "...", loc: loc}, nil
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		lex.pos++
+		return gqlToken{kind: gqlTokenPunct, value: string(c), loc: loc}, nil
+	case isNameStart(c):
+		start := lex.pos
+		for lex.pos < len(lex.src) && (isNameStart(lex.src[lex.pos]) || isDigit(lex.src[lex.pos])) {
+			lex.pos++
+		}
+		return gqlToken{kind: gqlTokenName, value: lex.src[start:lex.pos], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return lex.readNumber(loc)
+	case strings.HasPrefix(lex.src[lex.pos:], `"""`):
+		return lex.readBlockString(loc)
+	case c == '"':
+		return lex.readString(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(lex.src[lex.pos:])
+	return gqlToken{}, newGQLError(loc, "Syntax Error: Unexpected character %q.", r)
+}
+
+func (lex *gqlLexer) readDigits(loc gqlLocation) error {
+	start := lex.pos
+	for lex.pos < len(lex.src) && isDigit(lex.src[lex.pos]) {
+		lex.pos++
+	}
+	if lex.pos == start {
+		return newGQLError(loc, "Syntax Error: Invalid number, expected digit.")
+	}
+	return nil
+}
+
+func (lex *gqlLexer) readNumber(loc gqlLocation) (gqlToken, error) {
+	start := lex.pos
+	kind := gqlTokenInt
+	if lex.src[lex.pos] == '-' {
+		lex.pos++
+	}
+	if lex.pos < len(lex.src) && lex.src[lex.pos] == '0' {
+		lex.pos++
+		if lex.pos < len(lex.src) && isDigit(lex.src[lex.pos]) {
+			return gqlToken{}, newGQLError(loc, "Syntax Error: Invalid number, unexpected digit after 0.")
+		}
+	} else if err := lex.readDigits(loc); err != nil {
+		return gqlToken{}, err
+	}
+	if lex.pos < len(lex.src) && lex.src[lex.pos] == '.' {
+		kind = gqlTokenFloat
+		lex.pos++
+		if err := lex.readDigits(loc); err != nil {
+			return gqlToken{}, err
+		}
+	}
+	if lex.pos < len(lex.src) && (lex.src[lex.pos] == 'e' || lex.src[lex.pos] == 'E') {
+		kind = gqlTokenFloat
+		lex.pos++
+		if lex.pos < len(lex.src) && (lex.src[lex.pos] == '+' || lex.src[lex.pos] == '-') {
+			lex.pos++
+		}
+		if err := lex.readDigits(loc); err != nil {
+			return gqlToken{}, err
+		}
+	}
+	if lex.pos < len(lex.src) && (isNameStart(lex.src[lex.pos]) || lex.src[lex.pos] == '.') {
+		return gqlToken{}, newGQLError(loc, "Syntax Error: Invalid number, expected digit.")
+	}
+	return gqlToken{kind: kind, value: lex.src[start:lex.pos], loc: loc}, nil
+}
+
+func (lex *gqlLexer) readString(loc gqlLocation) (gqlToken, error) {
+	lex.pos++
+	var sb strings.Builder
+	for lex.pos < len(lex.src) {
+		c := lex.src[lex.pos]
+		switch {
+		case c == '"':
+			lex.pos++
+			return gqlToken{kind: gqlTokenString, value: sb.String(), loc: loc}, nil
+		case c == '\n' || c == '\r':
+			return gqlToken{}, newGQLError(loc, "Syntax Error: Unterminated string.")
+		case c == '\\' && lex.pos+1 < len(lex.src):
+			escaped := lex.src[lex.pos+1]
+			lex.pos += 2
+			switch escaped {
+			case '"', '\\', '/':
+				sb.WriteByte(escaped)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if lex.pos+4 > len(lex.src) {
+					return gqlToken{}, newGQLError(loc, "Syntax Error: Invalid Unicode escape sequence.")
+				}
+				code, err := strconv.ParseUint(lex.src[lex.pos:lex.pos+4], 16, 32)
+				if err != nil {
+					return gqlToken{}, newGQLError(loc, "Syntax Error: Invalid Unicode escape sequence.")
+				}
+				sb.WriteRune(rune(code))
+				lex.pos += 4
+			default:
+				return gqlToken{}, newGQLError(loc, "Syntax Error: Invalid character escape sequence: \\%c.", escaped)
+			}
+		default:
+			sb.WriteByte(c)
+			lex.pos++
+		}
+	}
+	return gqlToken{}, newGQLError(loc, "Syntax Error: Unterminated string.")
+}
+
+//readBlockString reads a """block string""", its common indentation
+//and leading and trailing blank lines are removed
+func (lex *gqlLexer) readBlockString(loc gqlLocation) (gqlToken, error) {
+	lex.pos += 3
+	end := strings.Index(lex.src[lex.pos:], `"""`)
+	for end > 0 && lex.src[lex.pos+end-1] == '\\' {
+		next := strings.Index(lex.src[lex.pos+end+3:], `"""`)
+		if next < 0 {
+			end = -1
+			break
+		}
+		end += 3 + next
+	}
+	if end < 0 {
+		return gqlToken{}, newGQLError(loc, "Syntax Error: Unterminated string.")
+	}
+	raw := lex.src[lex.pos : lex.pos+end]
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\n' {
+			lex.newLine(lex.pos + i + 1)
+		}
+	}
+	lex.pos += end + 3
+
+	lines := strings.Split(strings.ReplaceAll(strings.ReplaceAll(raw, `\"""`, `"""`), "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return gqlToken{kind: gqlTokenString, value: strings.Join(lines, "\n"), loc: loc}, nil
+}
+
+//Kinds of values of GraphQL documents
+const (
+	gqlValueVariable = iota
+	gqlValueInt
+	gqlValueFloat
+	gqlValueString
+	gqlValueBoolean
+	gqlValueNull
+	gqlValueEnum
+	gqlValueList
+	gqlValueObject
+)
+
+//gqlValue is a literal or a variable of a document
+type gqlValue struct {
+	kind   int
+	raw    string
+	list   []*gqlValue
+	fields []gqlObjectField
+	loc    gqlLocation
+}
+
+type gqlObjectField struct {
+	name  string
+	value *gqlValue
+	loc   gqlLocation
+}
+
+//gqlTypeRef is a type of a variable definition, either a named or a list type
+type gqlTypeRef struct {
+	name    string
+	list    *gqlTypeRef
+	nonNull bool
+}
+
+func (ref *gqlTypeRef) String() string {
+	s := ref.name
+	if ref.list != nil {
+		s = "[" + ref.list.String() + "]"
+	}
+	if ref.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+type gqlArgument struct {
+	name  string
+	value *gqlValue
+	loc   gqlLocation
+}
+
+type gqlDirective struct {
+	name string
+	args []gqlArgument
+	loc  gqlLocation
+}
+
+//Kinds of selections
+const (
+	gqlSelectField = iota
+	gqlSelectFragmentSpread
+	gqlSelectInlineFragment
+)
+
+//gqlSelection is a field, a fragment spread or an inline fragment
+type gqlSelection struct {
+	kind       int
+	alias      string
+	name       string
+	args       []gqlArgument
+	directives []gqlDirective
+	selections []*gqlSelection
+	//typeCondition of an inline fragment, it's empty if the fragment doesn't have it
+	typeCondition string
+	loc           gqlLocation
+}
+
+//responseKey returns a key of the field in the response
+func (sel *gqlSelection) responseKey() string {
+	if sel.alias != "" {
+		return sel.alias
+	}
+	return sel.name
+}
+
+type gqlVariableDefinition struct {
+	name         string
+	typ          *gqlTypeRef
+	defaultValue *gqlValue
+	loc          gqlLocation
+}
+
+type gqlOperation struct {
+	kind       string
+	name       string
+	variables  []gqlVariableDefinition
+	directives []gqlDirective
+	selections []*gqlSelection
+	loc        gqlLocation
+}
+
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	directives    []gqlDirective
+	selections    []*gqlSelection
+	loc           gqlLocation
+}
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+//gqlParser is a recursive descent parser of executable GraphQL documents
+type gqlParser struct {
+	lex gqlLexer
+	tok gqlToken
+}
+
+//parseGraphQL parses a document with operations and fragments
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{lex: gqlLexer{src: src, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for {
+		switch {
+		case p.tok.kind == gqlTokenEOF:
+			if len(doc.operations) == 0 {
+				return nil, newGQLError(p.tok.loc, "Syntax Error: Unexpected <EOF>.")
+			}
+			return doc, nil
+		case p.peek(gqlTokenPunct, "{"):
+			op := &gqlOperation{kind: "query", loc: p.tok.loc}
+			var err error
+			op.selections, err = p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(gqlTokenName, "query") || p.peek(gqlTokenName, "mutation") || p.peek(gqlTokenName, "subscription"):
+			op, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(gqlTokenName, "fragment"):
+			fragment, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[fragment.name]; ok {
+				return nil, newGQLError(fragment.loc, "There can be only one fragment named %q.", fragment.name)
+			}
+			doc.fragments[fragment.name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *gqlParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *gqlParser) peek(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *gqlParser) unexpected() error {
+	return newGQLError(p.tok.loc, "Syntax Error: Unexpected %s.", p.tok)
+}
+
+//skip advances if the current token is the punctuator and reports whether it was
+func (p *gqlParser) skip(punct string) (bool, error) {
+	if !p.peek(gqlTokenPunct, punct) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.peek(gqlTokenPunct, punct) {
+		return newGQLError(p.tok.loc, "Syntax Error: Expected %q, found %s.", punct, p.tok)
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	if p.tok.kind != gqlTokenName {
+		return "", newGQLError(p.tok.loc, "Syntax Error: Expected Name, found %s.", p.tok)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *gqlParser) expectKeyword(keyword string) error {
+	if !p.peek(gqlTokenName, keyword) {
+		return newGQLError(p.tok.loc, "Syntax Error: Expected %q, found %s.", keyword, p.tok)
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) parseOperation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: p.tok.value, loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.tok.kind == gqlTokenName {
+		if op.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek(gqlTokenPunct, "(") {
+		if op.variables, err = p.parseVariableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if op.directives, err = p.parseDirectives(false); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *gqlParser) parseVariableDefinitions() ([]gqlVariableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	defs := make([]gqlVariableDefinition, 0)
+	for {
+		if closed, err := p.skip(")"); closed || err != nil {
+			return defs, err
+		}
+		def := gqlVariableDefinition{loc: p.tok.loc}
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		var err error
+		if def.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if def.typ, err = p.parseTypeRef(); err != nil {
+			return nil, err
+		}
+		if hasDefault, err := p.skip("="); err != nil {
+			return nil, err
+		} else if hasDefault {
+			if def.defaultValue, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = p.parseDirectives(true); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+}
+
+func (p *gqlParser) parseTypeRef() (*gqlTypeRef, error) {
+	ref := &gqlTypeRef{}
+	if isList, err := p.skip("["); err != nil {
+		return nil, err
+	} else if isList {
+		if ref.list, err = p.parseTypeRef(); err != nil {
+			return nil, err
+		}
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+	} else if ref.name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	nonNull, err := p.skip("!")
+	ref.nonNull = nonNull
+	return ref, err
+}
+
+func (p *gqlParser) parseFragment() (*gqlFragment, error) {
+	fragment := &gqlFragment{loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.peek(gqlTokenName, "on") {
+		return nil, p.unexpected()
+	}
+	if fragment.name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("on"); err != nil {
+		return nil, err
+	}
+	if fragment.typeCondition, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if fragment.directives, err = p.parseDirectives(false); err != nil {
+		return nil, err
+	}
+	if fragment.selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	selections := make([]*gqlSelection, 0)
+	for {
+		if closed, err := p.skip("}"); err != nil {
+			return nil, err
+		} else if closed {
+			if len(selections) == 0 {
+				return nil, newGQLError(p.tok.loc, "Syntax Error: Expected Name, found \"}\".")
+			}
+			return selections, nil
+		}
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+}
+
+func (p *gqlParser) parseSelection() (*gqlSelection, error) {
+	sel := &gqlSelection{loc: p.tok.loc}
+	var err error
+	if isFragment, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if isFragment {
+		sel.kind = gqlSelectInlineFragment
+		if p.peek(gqlTokenName, "on") {
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+			if sel.typeCondition, err = p.expectName(); err != nil {
+				return nil, err
+			}
+		} else if p.tok.kind == gqlTokenName {
+			sel.kind = gqlSelectFragmentSpread
+			sel.name = p.tok.value
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+			sel.directives, err = p.parseDirectives(false)
+			return sel, err
+		}
+		if sel.directives, err = p.parseDirectives(false); err != nil {
+			return nil, err
+		}
+		sel.selections, err = p.parseSelectionSet()
+		return sel, err
+	}
+
+	sel.kind = gqlSelectField
+	if sel.name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if hasAlias, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if hasAlias {
+		sel.alias = sel.name
+		if sel.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek(gqlTokenPunct, "(") {
+		if sel.args, err = p.parseArguments(false); err != nil {
+			return nil, err
+		}
+	}
+	if sel.directives, err = p.parseDirectives(false); err != nil {
+		return nil, err
+	}
+	if p.peek(gqlTokenPunct, "{") {
+		if sel.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) parseArguments(isConst bool) ([]gqlArgument, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make([]gqlArgument, 0)
+	for {
+		if closed, err := p.skip(")"); err != nil {
+			return nil, err
+		} else if closed {
+			if len(args) == 0 {
+				return nil, newGQLError(p.tok.loc, "Syntax Error: Expected Name, found \")\".")
+			}
+			return args, nil
+		}
+		arg := gqlArgument{loc: p.tok.loc}
+		var err error
+		if arg.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if arg.value, err = p.parseValue(isConst); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+}
+
+func (p *gqlParser) parseDirectives(isConst bool) ([]gqlDirective, error) {
+	var directives []gqlDirective
+	for p.peek(gqlTokenPunct, "@") {
+		directive := gqlDirective{loc: p.tok.loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if directive.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		if p.peek(gqlTokenPunct, "(") {
+			if directive.args, err = p.parseArguments(isConst); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+//parseValue parses a value, variables aren't allowed in constant values like defaults
+func (p *gqlParser) parseValue(isConst bool) (*gqlValue, error) {
+	value := &gqlValue{raw: p.tok.value, loc: p.tok.loc}
+	switch {
+	case p.peek(gqlTokenPunct, "$") && !isConst:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		value.kind = gqlValueVariable
+		var err error
+		value.raw, err = p.expectName()
+		return value, err
+	case p.peek(gqlTokenPunct, "["):
+		value.kind = gqlValueList
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for {
+			if closed, err := p.skip("]"); closed || err != nil {
+				return value, err
+			}
+			item, err := p.parseValue(isConst)
+			if err != nil {
+				return nil, err
+			}
+			value.list = append(value.list, item)
+		}
+	case p.peek(gqlTokenPunct, "{"):
+		value.kind = gqlValueObject
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for {
+			if closed, err := p.skip("}"); closed || err != nil {
+				return value, err
+			}
+			field := gqlObjectField{loc: p.tok.loc}
+			var err error
+			if field.name, err = p.expectName(); err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if field.value, err = p.parseValue(isConst); err != nil {
+				return nil, err
+			}
+			value.fields = append(value.fields, field)
+		}
+	case p.tok.kind == gqlTokenInt:
+		value.kind = gqlValueInt
+	case p.tok.kind == gqlTokenFloat:
+		value.kind = gqlValueFloat
+	case p.tok.kind == gqlTokenString:
+		value.kind = gqlValueString
+	case p.peek(gqlTokenName, "true") || p.peek(gqlTokenName, "false"):
+		value.kind = gqlValueBoolean
+	case p.peek(gqlTokenName, "null"):
+		value.kind = gqlValueNull
+	case p.tok.kind == gqlTokenName:
+		value.kind = gqlValueEnum
+	default:
+		return nil, p.unexpected()
+	}
+	return value, p.advance()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//importBatchSize is a number of rows inserted by a single query
+const importBatchSize = 100
+
+//maxNDJSONLineSize is a limit of a line of an imported NDJSON file
+const maxNDJSONLineSize = 1 << 20
+
+//ImportLineError describes a line of an imported file which isn't inserted
+type ImportLineError struct {
+	Line  int    `json:"line"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+//ImportReport is an answer of POST /$table/_import
+type ImportReport struct {
+	//Inserted is a number of inserted rows, it's zero for dry runs
+	Inserted int64 `json:"inserted"`
+	//Valid is a number of rows which passed validation
+	Valid  int               `json:"valid"`
+	DryRun bool              `json:"dry_run"`
+	Errors []ImportLineError `json:"errors"`
+}
+
+//importLineError is returned by importSource for a broken line,
+//the rest of the lines can still be read
+type importLineError struct {
+	ImportLineError
+}
+
+func (lErr importLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", lErr.Line, lErr.ImportLineError.Error)
+}
+
+//importRecord is a row of an imported file
+type importRecord struct {
+	line   int
+	params map[string]interface{}
+}
+
+//importSource reads rows of an imported file one by one, io.EOF is returned at the end
+type importSource interface {
+	next() (importRecord, error)
+}
+
+//newImportSource returns a reader of the body chosen by Content-Type
+func newImportSource(r *http.Request, table TableDesc, null string) (importSource, error) {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, unsupportedContentTypeError{contentType}
+	}
+	switch mediaType {
+	case contentTypeCSV:
+		return newCSVSource(r.Body, ',', table, null)
+	case contentTypeTSV:
+		return newCSVSource(r.Body, '\t', table, null)
+	case contentTypeNDJSON:
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineSize)
+		return &ndjsonSource{scanner: scanner}, nil
+	default:
+		return nil, unsupportedContentTypeError{contentType}
+	}
+}
+
+//csvSource reads rows of CSV or TSV files, the first line is a header
+//with names of fields, unknown fields are ignored
+type csvSource struct {
+	reader *csv.Reader
+	header []string
+	table  TableDesc
+	null   string
+}
+
+func newCSVSource(body io.Reader, comma rune, table TableDesc, null string) (*csvSource, error) {
+	reader := csv.NewReader(body)
+	reader.Comma = comma
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return &csvSource{reader: reader, header: header, table: table, null: null}, nil
+}
+
+func (source *csvSource) next() (importRecord, error) {
+	values, err := source.reader.Read()
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return importRecord{}, importLineError{ImportLineError{Line: parseErr.Line, Error: parseErr.Err.Error()}}
+		}
+		return importRecord{}, err
+	}
+	line, _ := source.reader.FieldPos(0)
+
+	params := make(map[string]interface{}, len(values))
+	for i, name := range source.header {
+		field, ok := source.table.fields[name]
+		if !ok {
+			continue
+		}
+		if values[i] == source.null && field.Nullable {
+			params[name] = nil
+			continue
+		}
+		params[name], err = field.parseFormValue(values[i])
+		if err != nil {
+			return importRecord{}, importLineError{ImportLineError{Line: line, Field: name, Error: err.Error()}}
+		}
+	}
+	return importRecord{line: line, params: params}, nil
+}
+
+//ndjsonSource reads rows of newline delimited JSON, empty lines are skipped
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (source *ndjsonSource) next() (importRecord, error) {
+	for source.scanner.Scan() {
+		source.line++
+		text := strings.TrimSpace(source.scanner.Text())
+		if text == "" {
+			continue
+		}
+		params := make(map[string]interface{})
+		err := json.Unmarshal([]byte(text), &params)
+		if err != nil {
+			return importRecord{}, importLineError{ImportLineError{Line: source.line, Error: err.Error()}}
+		}
+		return importRecord{line: source.line, params: params}, nil
+	}
+	if err := source.scanner.Err(); err != nil {
+		return importRecord{}, err
+	}
+	return importRecord{}, io.EOF
+}
+
+//serveImport inserts rows of a CSV, TSV or NDJSON body into the table by batches
+//and answers with ImportReport. Rows are validated like ones of PUT /$table,
+//invalid rows are reported and skipped, nothing is written for ?dry_run=true
+func serveImport(w http.ResponseWriter, r *http.Request, l *Router, table TableDesc) {
+	source, err := newImportSource(r, table, l.nullRepresentation(r))
+	if err != nil {
+		bodyError(err).serve(w, r, l)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	ctx, cancel := l.requestContext(r, RouteImport)
+	defer cancel()
+
+	report := ImportReport{DryRun: dryRun, Errors: make([]ImportLineError, 0)}
+	batch := make([]importRecord, 0, importBatchSize)
+	for {
+		record, err := source.next()
+		if err == io.EOF {
+			break
+		}
+		if lineErr, ok := err.(importLineError); ok {
+			report.Errors = append(report.Errors, lineErr.ImportLineError)
+			continue
+		}
+		if err != nil {
+			log.Println("can't read an imported file:", err)
+			bodyError(err).serve(w, r, l)
+			return
+		}
+
+		if lineErr := validateImportRecord(table, record); lineErr != nil {
+			report.Errors = append(report.Errors, *lineErr)
+			continue
+		}
+		report.Valid++
+		if dryRun {
+			continue
+		}
+
+		batch = append(batch, record)
+		if len(batch) == importBatchSize {
+			err = l.insertImportBatch(ctx, table, batch, &report)
+			if err != nil {
+				dbError(err).serve(w, r, l)
+				return
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		err = l.insertImportBatch(ctx, table, batch, &report)
+		if err != nil {
+			dbError(err).serve(w, r, l)
+			return
+		}
+	}
+
+	serveAnswer(w, r, l, map[string]interface{}{"response": report})
+}
+
+//validateImportRecord checks values of known fields, the primary key is ignored
+//as it is for PUT /$table
+func validateImportRecord(table TableDesc, record importRecord) *ImportLineError {
+	for name, value := range record.params {
+		field, ok := table.fields[name]
+		if !ok || field.IsPrimaryKey {
+			continue
+		}
+		if err := field.validate(value); err != nil {
+			return &ImportLineError{Line: record.line, Field: name, Error: err.Error()}
+		}
+	}
+	return nil
+}
+
+//insertImportBatch inserts the batch by a single query. If the query fails
+//the rows are inserted one by one to find the lines which can't be inserted.
+//An error is returned only if the import can't be continued
+func (l *Router) insertImportBatch(ctx context.Context, table TableDesc, batch []importRecord, report *ImportReport) error {
+	args := make([]interface{}, 0, len(batch)*len(table.fields))
+	for _, record := range batch {
+		args = append(args, table.prepInsertValues(record.params)...)
+	}
+	res, err := l.db.ExecContext(ctx, table.prepBatchInsertSqlQuery(len(batch)), args...)
+	if err == nil {
+		inserted, _ := res.RowsAffected()
+		report.Inserted += inserted
+		return nil
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+
+	log.Println("batch insert failed, inserting rows one by one:", err)
+	for _, record := range batch {
+		_, err = l.db.ExecContext(ctx, table.prepInsertSqlQuery(), table.prepInsertValues(record.params)...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			report.Errors = append(report.Errors, ImportLineError{Line: record.line, Error: dbError(err).Error})
+			continue
+		}
+		report.Inserted++
+	}
+	return nil
+}
+
+//prepBatchInsertSqlQuery returns prepInsertSqlQuery inserting rowsNumber rows at once
+func (tDesc TableDesc) prepBatchInsertSqlQuery(rowsNumber int) string {
+	query := tDesc.prepInsertSqlQuery()
+	rowPlaceholders := query[strings.LastIndex(query, "("):]
+	return query + strings.Repeat(", "+rowPlaceholders, rowsNumber-1)
+}
@@ -3,9 +3,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
+	"os"
+	"syscall"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -25,7 +28,17 @@ func main() {
 		panic(err)
 	}
 
-	handler, err := NewDbExplorer(db)
+	// вместо запуска сервера можно выполнить команду, например dump или restore
+	if len(os.Args) > 1 {
+		err = runCommand(db, os.Args[1:], os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	handler, err := NewDbExplorer(db, WithReloadOnSignal(context.Background(), syscall.SIGHUP))
 	if err != nil {
 		panic(err)
 	}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"bytes"
@@ -11,9 +14,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 // CaseResponse
@@ -26,6 +32,14 @@ type Case struct {
 	Status int
 	Result interface{}
 	Body   interface{}
+	// Content-Type тела запроса, по-умолчанию application/json
+	ContentType string
+	// Token передаётся в заголовке Authorization: Bearer для admin эндпоинтов
+	Token string
+	// Accept передаётся в одноимённом заголовке, если не пустой
+	Accept string
+	// ResultContentType - ожидаемый Content-Type ответа, не проверяется если пустой
+	ResultContentType string
 }
 
 var (
@@ -500,70 +514,2815 @@ func TestApis(t *testing.T) {
 	runCases(t, ts, db, cases)
 }
 
+func TestFormBodies(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:        "/items/",
+			Method:      http.MethodPut,
+			ContentType: "application/x-www-form-urlencoded",
+			Body: CR{
+				"title":       "form",
+				"description": "created by a form",
+			},
+			Result: CR{
+				"response": CR{
+					"id": 3,
+				},
+			},
+		},
+		Case{
+			Path:        "/items/3",
+			Method:      http.MethodPost,
+			ContentType: "application/x-www-form-urlencoded",
+			Body: CR{
+				"updated": "form",
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/items/3",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          3,
+						"title":       "form",
+						"description": "created by a form",
+						"updated":     "form",
+					},
+				},
+			},
+		},
+		// строковое значение формы конвертируется по типу поля
+		Case{
+			Path:        "/users/1",
+			Method:      http.MethodPost,
+			ContentType: "application/x-www-form-urlencoded",
+			Status:      http.StatusBadRequest,
+			Body: CR{
+				"user_id": "abc",
+			},
+			Result: CR{
+				"error": "field user_id have invalid type",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestProblemErrors(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db, WithLegacyErrors(false))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:   "/unknown_table",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"type":     "about:blank",
+				"title":    "Not Found",
+				"status":   http.StatusNotFound,
+				"detail":   "unknown table",
+				"instance": "/unknown_table",
+			},
+		},
+		Case{
+			Path:   "/items/1",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title": 42,
+			},
+			Result: CR{
+				"type":     "urn:problem-type:invalid-field",
+				"title":    "Bad Request",
+				"status":   http.StatusBadRequest,
+				"detail":   "field title have invalid type",
+				"instance": "/items/1",
+				"errors": []CR{
+					CR{"field": "title", "detail": "invalid type"},
+				},
+			},
+		},
+		Case{
+			Path:        "/items/",
+			Method:      http.MethodPut,
+			ContentType: "text/plain",
+			Status:      http.StatusUnsupportedMediaType,
+			Body:        CR{},
+			Result: CR{
+				"type":     "about:blank",
+				"title":    "Unsupported Media Type",
+				"status":   http.StatusUnsupportedMediaType,
+				"detail":   "unsupported content type: text/plain",
+				"instance": "/items/",
+			},
+		},
+		Case{
+			Path:   "/items/1",
+			Method: http.MethodPatch,
+			Status: http.StatusMethodNotAllowed,
+			Body:   CR{},
+			Result: CR{
+				"type":     "about:blank",
+				"title":    "Method Not Allowed",
+				"status":   http.StatusMethodNotAllowed,
+				"detail":   "Method not allowed",
+				"instance": "/items/1",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+
+	// синтаксические ошибки запросов самого сервиса не раскрываются клиенту,
+	// текст ошибки отдаётся только для запросов клиента из дампов и миграций
+	syntaxErr := &mysql.MySQLError{Number: mysqlErrParse, Message: "You have an error in your SQL syntax"}
+	if rErr := dbError(syntaxErr); rErr.HTTPStatus != http.StatusInternalServerError || rErr.Error != "Internal Server Error" {
+		t.Fatalf("unexpected error of a syntax error: %+v", rErr)
+	}
+	rErr := statementError(restoreError{Statement: 2, Err: syntaxErr})
+	if rErr.HTTPStatus != http.StatusBadRequest || rErr.Error != syntaxErr.Message {
+		t.Fatalf("unexpected error of a syntax error of a statement: %+v", rErr)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db, WithRouteTimeout(RouteListRows, time.Nanosecond))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:   "/items",
+			Status: http.StatusGatewayTimeout,
+			Result: CR{
+				"error": "database timeout",
+			},
+		},
+		// у остальных маршрутов таймаута нет
+		Case{
+			Path: "/users/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id":  1,
+						"login":    "rvasily",
+						"password": "love",
+						"email":    "rvasily@example.com",
+						"info":     "none",
+						"updated":  nil,
+					},
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestStreamingLists(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db, WithMaxLimit(1))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	// лимит больше максимального уменьшается до него
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items",
+			Query: "limit=100",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/items?offset=1", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("can't read body: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("expected application/x-ndjson, got %s", ct)
+	}
+	expected := `{"description":"Рассказать про мемкеш с примером использования","id":2,"title":"memcache","updated":null}` + "\n"
+	if string(body) != expected {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", body, expected)
+	}
+}
+
+func TestExports(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	get := func(query string, accept string) ([]byte, *http.Response) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/items?"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("can't read body: %v", err)
+		}
+		return body, resp
+	}
+
+	body, _ := get("null=NULL", "text/csv")
+	expected := "id,title,description,updated\n" +
+		"1,database/sql,Рассказать про базы данных,rvasily\n" +
+		"2,memcache,Рассказать про мемкеш с примером использования,NULL\n"
+	if string(body) != expected {
+		t.Fatalf("csv not match\nGot : %s\nWant: %s", body, expected)
+	}
+
+	body, _ = get("format=tsv&limit=1", "")
+	expected = "id\ttitle\tdescription\tupdated\n" +
+		"1\tdatabase/sql\tРассказать про базы данных\trvasily\n"
+	if string(body) != expected {
+		t.Fatalf("tsv not match\nGot : %s\nWant: %s", body, expected)
+	}
+
+	body, resp := get("format=xlsx", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status 200, got %v", resp.StatusCode)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip archive: %v", err)
+	}
+	var sheet []byte
+	for _, file := range archive.File {
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := file.Open()
+			sheet, _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	if !bytes.Contains(sheet, []byte(`<c r="A3"><v>2</v></c>`)) ||
+		!bytes.Contains(sheet, []byte(`<t xml:space="preserve">memcache</t>`)) {
+		t.Fatalf("unexpected sheet: %s", sheet)
+	}
+
+	_, resp = get("format=pdf", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected http status 400 for unknown format, got %v", resp.StatusCode)
+	}
+
+	// длинное имя листа обрезается по символам, а не по байтам
+	if name := sheetName(strings.Repeat("я", 40)); name != strings.Repeat("я", 31) {
+		t.Fatalf("unexpected sheet name %q", name)
+	}
+}
+
+func TestImport(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	post := func(query string, contentType string, body string) interface{} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/items/_import?"+query, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected http status 200, got %v", resp.StatusCode)
+		}
+		var result interface{}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if err = json.Unmarshal(data, &result); err != nil {
+			t.Fatalf("cant unpack json: %v", err)
+		}
+		return result
+	}
+	check := func(name string, result interface{}, expected CR) {
+		var want interface{}
+		data, _ := json.Marshal(expected)
+		json.Unmarshal(data, &want)
+		if !reflect.DeepEqual(result, want) {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: %#v", name, result, want)
+		}
+	}
+
+	// NDJSON в режиме проверки ничего не вставляет
+	result := post("dry_run=true", "application/x-ndjson",
+		`{"title": "a", "description": "b"}`+"\n\n"+`{"title": 1, "description": "c"}`+"\n")
+	check("ndjson dry run", result, CR{
+		"response": CR{
+			"inserted": 0,
+			"valid":    1,
+			"dry_run":  true,
+			"errors": []CR{
+				CR{"line": 3, "field": "title", "error": "field title have invalid type"},
+			},
+		},
+	})
+
+	// id игнорируется, как и при PUT, а пустое значение nullable-поля становится NULL
+	result = post("", "text/csv", "id,title,description,updated,unknown\n"+
+		"42,csv,imported,,x\n"+
+		"43,broken\n"+
+		"44,csv2,imported,upd,x\n")
+	check("csv", result, CR{
+		"response": CR{
+			"inserted": 2,
+			"valid":    2,
+			"dry_run":  false,
+			"errors": []CR{
+				CR{"line": 3, "error": "wrong number of fields"},
+			},
+		},
+	})
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items",
+			Query: "offset=2",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 3, "title": "csv", "description": "imported", "updated": nil},
+						CR{"id": 4, "title": "csv2", "description": "imported", "updated": "upd"},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestDump(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	disabledHandler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	disabledTs := httptest.NewServer(disabledHandler)
+	runCases(t, disabledTs, db, []Case{
+		Case{
+			Path:   "/_dump",
+			Status: http.StatusForbidden,
+			Result: CR{"error": "admin endpoints are disabled"},
+		},
+		Case{
+			Path:        "/_dump",
+			Method:      http.MethodPost,
+			Body:        "DELETE FROM items",
+			ContentType: "application/sql",
+			Status:      http.StatusForbidden,
+			Result:      CR{"error": "admin endpoints are disabled"},
+		},
+	})
+
+	handler, err := NewDbExplorer(db, WithAdminToken("secret"))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/_dump",
+			Token:  "wrong",
+			Status: http.StatusUnauthorized,
+			Result: CR{"error": "unauthorized"},
+		},
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/_dump?tables=items", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	dump, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, expected := range []string{
+		"DROP TABLE IF EXISTS `items`;\nCREATE TABLE `items`",
+		"INSERT INTO `items` (`id`, `title`, `description`, `updated`) VALUES\n" +
+			"(1,\t'database/sql',\t'Рассказать про базы данных',\t'rvasily'),\n" +
+			"(2,\t'memcache',\t'Рассказать про мемкеш с примером использования',\tNULL);\n",
+	} {
+		if !bytes.Contains(dump, []byte(expected)) {
+			t.Fatalf("dump doesn't contain %q:\n%s", expected, dump)
+		}
+	}
+	if bytes.Contains(dump, []byte("`users`")) {
+		t.Fatalf("dump contains a table which isn't asked for:\n%s", dump)
+	}
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/items/2",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+	})
+
+	// восстанавливаем удалённую запись из дампа
+	req, _ = http.NewRequest(http.MethodPost, ts.URL+"/_dump", bytes.NewReader(dump))
+	req.Header.Set("Content-Type", "application/sql")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status 200, got %v: %s", resp.StatusCode, body)
+	}
+	// соединение восстановления закрывается, чтобы SET foreign_key_checks = 0 из дампа
+	// не достался другим запросам
+	if db.Stats().OpenConnections != 0 {
+		t.Fatalf("the connection of a restore is returned to the pool")
+	}
+	var fkChecks int
+	err = db.QueryRow("SELECT @@SESSION.foreign_key_checks").Scan(&fkChecks)
+	if err != nil || fkChecks != 1 {
+		t.Fatalf("foreign_key_checks of a session after a restore is %d, %v", fkChecks, err)
+	}
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path: "/items/2",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          2,
+						"title":       "memcache",
+						"description": "Рассказать про мемкеш с примером использования",
+						"updated":     nil,
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestEncoders(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []struct {
+		Path        string
+		Query       string
+		Accept      string
+		Status      int
+		ContentType string
+		Body        []byte
+	}{
+		{
+			Path:        "/",
+			Accept:      "application/msgpack",
+			Status:      http.StatusOK,
+			ContentType: "application/msgpack",
+			Body: append(append(append([]byte{0x81, 0xa8}, "response"...), 0x81, 0xa6),
+				append(append(append([]byte("tables"), 0x92, 0xa5), "items"...), append([]byte{0xa5}, "users"...)...)...),
+		},
+		{
+			Path:        "/unknown_table",
+			Accept:      "application/cbor",
+			Status:      http.StatusNotFound,
+			ContentType: "application/cbor",
+			Body:        append(append(append([]byte{0xa1, 0x65}, "error"...), 0x6d), "unknown table"...),
+		},
+		{
+			Path:        "/items/2",
+			Accept:      "text/html, application/xml;q=0.9, */*;q=0.1",
+			Status:      http.StatusOK,
+			ContentType: "application/xml",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<response><record><description>Рассказать про мемкеш с примером использования</description>` +
+				`<id>2</id><title>memcache</title><updated nil="true"/></record></response>`),
+		},
+		{
+			Path:        "/items/100500",
+			Accept:      "application/problem+xml",
+			Status:      http.StatusNotFound,
+			ContentType: "application/problem+xml",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<problem xmlns="urn:ietf:rfc:7807"><type>about:blank</type><title>Not Found</title>` +
+				`<status>404</status><detail>record not found</detail><instance>/items/100500</instance></problem>`),
+		},
+		{
+			Path:        "/items",
+			Query:       "offset=1",
+			Accept:      "application/xml",
+			Status:      http.StatusOK,
+			ContentType: "application/xml",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<response><records><i><description>Рассказать про мемкеш с примером использования</description>` +
+				`<id>2</id><title>memcache</title><updated nil="true"/></i></records></response>`),
+		},
+	}
+
+	for _, item := range cases {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+item.Path+"?"+item.Query, nil)
+		req.Header.Set("Accept", item.Accept)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[%s] request error: %v", item.Accept, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Fatalf("[%s] expected http status %v, got %v", item.Accept, item.Status, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != item.ContentType {
+			t.Fatalf("[%s] expected content type %s, got %s", item.Accept, item.ContentType, ct)
+		}
+		if !bytes.Equal(body, item.Body) {
+			t.Fatalf("[%s] results not match\nGot : %q\nWant: %q", item.Accept, body, item.Body)
+		}
+	}
+}
+
 func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
 	for idx, item := range cases {
-		var (
-			err      error
-			result   interface{}
-			expected interface{}
-			req      *http.Request
-		)
+		var (
+			err      error
+			result   interface{}
+			expected interface{}
+			req      *http.Request
+		)
+
+		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
+
+		// если у вас случилась это ошибка - значит вы не делаете где-то rows.Close и у вас текут соединения с базой
+		// если такое случилось на первом тесте - значит вы не закрываете коннект где-то при иницаилизации в NewDbExplorer
+		if db.Stats().OpenConnections != 1 {
+			t.Fatalf("[%s] you have %d open connections, must be 1", caseName, db.Stats().OpenConnections)
+		}
+
+		if item.Method == "" || item.Method == http.MethodGet {
+			req, err = http.NewRequest(item.Method, ts.URL+item.Path+"?"+item.Query, nil)
+		} else {
+			if item.ContentType == "" {
+				item.ContentType = "application/json"
+			}
+			var data []byte
+			if item.ContentType == "application/x-www-form-urlencoded" {
+				form := url.Values{}
+				for k, v := range item.Body.(CR) {
+					form.Set(k, fmt.Sprint(v))
+				}
+				data = []byte(form.Encode())
+			} else {
+				data, err = json.Marshal(item.Body)
+				if err != nil {
+					panic(err)
+				}
+			}
+			reqBody := bytes.NewReader(data)
+			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
+			req.Header.Add("Content-Type", item.ContentType)
+		}
+
+		if item.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+item.Token)
+		}
+		if item.Accept != "" {
+			req.Header.Set("Accept", item.Accept)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[%s] request error: %v", caseName, err)
+			continue
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+
+		// fmt.Printf("[%s] body: %s\n", caseName, string(body))
+		if item.Status == 0 {
+			item.Status = http.StatusOK
+		}
+
+		if resp.StatusCode != item.Status {
+			t.Fatalf("[%s] expected http status %v, got %v", caseName, item.Status, resp.StatusCode)
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); item.ResultContentType != "" && ct != item.ResultContentType {
+			t.Fatalf("[%s] expected content type %s, got %s", caseName, item.ResultContentType, ct)
+			continue
+		}
+
+		err = json.Unmarshal(body, &result)
+		if err != nil {
+			t.Fatalf("[%s] cant unpack json: %v", caseName, err)
+			continue
+		}
+
+		// reflect.DeepEqual не работает если нам приходят разные типы
+		// а там приходят разные типы (string VS interface{}) по сравнению с тем что в ожидаемом результате
+		// этот маленький грязный хак конвертит данные сначала в json, а потом обратно в interface - получаем совместимые результаты
+		// не используйте это в продакшен-коде - надо явно писать что ожидается интерфейс или использовать другой подход с точным форматом ответа
+		data, err := json.Marshal(item.Result)
+		json.Unmarshal(data, &expected)
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: %#v", caseName, result, expected)
+			continue
+		}
+	}
+
+}
+
+func TestRepresentations(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db, WithBasePath("/api"))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		{
+			Path:              "/users/1",
+			Accept:            "application/vnd.api+json",
+			Status:            http.StatusOK,
+			ResultContentType: "application/vnd.api+json",
+			Result: CR{
+				"data": CR{
+					"type": "users",
+					"id":   "1",
+					"attributes": CR{
+						"login":    "rvasily",
+						"password": "love",
+						"email":    "rvasily@example.com",
+						"info":     "none",
+						"updated":  nil,
+					},
+					"links": CR{"self": "/api/users/1"},
+				},
+				"links": CR{"self": "/api/users/1"},
+			},
+		},
+		{
+			Path:              "/items",
+			Query:             "limit=1&offset=1",
+			Accept:            "application/vnd.api+json",
+			Status:            http.StatusOK,
+			ResultContentType: "application/vnd.api+json",
+			Result: CR{
+				"data": []CR{
+					CR{
+						"type": "items",
+						"id":   "2",
+						"attributes": CR{
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+						},
+						"links": CR{"self": "/api/items/2"},
+					},
+				},
+				"links": CR{
+					"self":  "/api/items?limit=1&offset=1",
+					"first": "/api/items?limit=1&offset=0",
+					"prev":  "/api/items?limit=1&offset=0",
+					"next":  "/api/items?limit=1&offset=2",
+				},
+			},
+		},
+		{
+			Path:              "/items",
+			Query:             "limit=0",
+			Accept:            "application/vnd.api+json",
+			Status:            http.StatusOK,
+			ResultContentType: "application/vnd.api+json",
+			Result: CR{
+				"data": []CR{},
+				"links": CR{
+					"self":  "/api/items?limit=0&offset=0",
+					"first": "/api/items?limit=0&offset=0",
+				},
+			},
+		},
+		{
+			Path:              "/items/100500",
+			Accept:            "application/vnd.api+json",
+			Status:            http.StatusNotFound,
+			ResultContentType: "application/vnd.api+json",
+			Result: CR{
+				"errors": []CR{
+					CR{"status": "404", "title": "Not Found", "detail": "record not found"},
+				},
+			},
+		},
+		{
+			Path:              "/items",
+			Query:             "offset=1",
+			Accept:            "application/hal+json",
+			Status:            http.StatusOK,
+			ResultContentType: "application/hal+json",
+			Result: CR{
+				"_embedded": CR{
+					"items": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+							"_links":      CR{"self": CR{"href": "/api/items/2"}},
+						},
+					},
+				},
+				"_links": CR{
+					"self":  CR{"href": "/api/items?limit=5&offset=1"},
+					"first": CR{"href": "/api/items?limit=5&offset=0"},
+					"prev":  CR{"href": "/api/items?limit=5&offset=0"},
+				},
+			},
+		},
+		{
+			Path:              "/items/1",
+			Accept:            "application/hal+json",
+			Status:            http.StatusOK,
+			ResultContentType: "application/hal+json",
+			Result: CR{
+				"id":          1,
+				"title":       "database/sql",
+				"description": "Рассказать про базы данных",
+				"updated":     "rvasily",
+				"_links":      CR{"self": CR{"href": "/api/items/1"}},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestOpenAPI(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	resp, err := client.Get(ts.URL + "/_openapi.json")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status 200, got %v", resp.StatusCode)
+	}
+
+	var doc struct {
+		OpenAPI    string                     `json:"openapi"`
+		Paths      map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas    map[string]interface{} `json:"schemas"`
+			Parameters map[string]interface{} `json:"parameters"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(body, &doc)
+	if err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("expected openapi 3.1.0, got %q", doc.OpenAPI)
+	}
+	for _, path := range []string{"/", "/items", "/items/{id}", "/users", "/users/{id}", "/items/_import", "/items/_schema", "/items/_aggregate",
+		"/items/_distinct/{column}"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Fatalf("path %s is missing", path)
+		}
+	}
+	for _, parameter := range []string{"limit", "offset", "format", "null", "groupLimit", "facet_size",
+		"sample", "sample_pct", "seed"} {
+		if _, ok := doc.Components.Parameters[parameter]; !ok {
+			t.Fatalf("parameter %s is missing", parameter)
+		}
+	}
+	for _, parameter := range []string{"facets", "sample", "sample_pct", "seed"} {
+		if !bytes.Contains(doc.Paths["/items"], []byte(`"name":"`+parameter+`"`)) &&
+			!bytes.Contains(doc.Paths["/items"], []byte(`"#/components/parameters/`+parameter+`"`)) {
+			t.Fatalf("parameter %s of /items is missing", parameter)
+		}
+	}
+
+	var expected interface{}
+	data, _ := json.Marshal(CR{
+		"type": "object",
+		"properties": CR{
+			"id":          CR{"type": "integer", "readOnly": true},
+			"title":       CR{"type": "string", "maxLength": 255},
+			"description": CR{"type": "string"},
+			"updated":     CR{"type": []string{"string", "null"}, "maxLength": 255},
+		},
+		"required": []string{"id", "title", "description", "updated"},
+	})
+	json.Unmarshal(data, &expected)
+	if !reflect.DeepEqual(doc.Components.Schemas["items"], expected) {
+		t.Fatalf("schema of items not match\nGot : %#v\nWant: %#v", doc.Components.Schemas["items"], expected)
+	}
+}
+
+func TestTableSchema(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN role enum('admin','it''s me') DEFAULT NULL")
+	if err != nil {
+		panic(err)
+	}
+	// колонка со значением по-умолчанию не обязательна, хоть и не NULL
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN karma int NOT NULL DEFAULT 0")
+	if err != nil {
+		panic(err)
+	}
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	resp, err := client.Get(ts.URL + "/users/_schema")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected http status 200, got %v", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/schema+json" {
+		t.Fatalf("expected content type application/schema+json, got %s", ct)
+	}
+
+	var result, expected interface{}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+	data, _ := json.Marshal(CR{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "/users/_schema",
+		"title":   "users",
+		"type":    "object",
+		"properties": CR{
+			"user_id":  CR{"type": "integer", "readOnly": true},
+			"login":    CR{"type": "string", "maxLength": 255},
+			"password": CR{"type": "string", "maxLength": 255},
+			"email":    CR{"type": "string", "maxLength": 255},
+			"info":     CR{"type": "string"},
+			"updated":  CR{"type": []string{"string", "null"}, "maxLength": 255},
+			"role":     CR{"type": []string{"string", "null"}, "enum": []interface{}{"admin", "it's me", nil}},
+			"karma":    CR{"type": "integer"},
+		},
+		"required": []string{"login", "password", "email", "info"},
+	})
+	json.Unmarshal(data, &expected)
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", result, expected)
+	}
+
+	resp, err = client.Get(ts.URL + "/unknown_table/_schema")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected http status 404, got %v", resp.StatusCode)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []struct {
+		Method    string
+		Query     string
+		Variables CR
+		Status    int
+		Body      string
+	}{
+		{
+			Query:  `{ items(sort: [id_DESC], limit: 1) { id title } }`,
+			Status: http.StatusOK,
+			Body:   `{"data":{"items":[{"id":2,"title":"memcache"}]}}`,
+		},
+		{
+			Query: `query Item($id: Int!) {
+				first: items_by_pk(id: $id) { ...itemFields }
+				missing: items_by_pk(id: 100500) { id }
+			}
+			fragment itemFields on items { __typename title updated }`,
+			Variables: CR{"id": 1},
+			Status:    http.StatusOK,
+			Body:      `{"data":{"first":{"__typename":"items","title":"database/sql","updated":"rvasily"},"missing":null}}`,
+		},
+		{
+			Query:  `{ items(filter: {updated: null}) { id updated @include(if: false) } }`,
+			Status: http.StatusOK,
+			Body:   `{"data":{"items":[{"id":2}]}}`,
+		},
+		{
+			Query: `mutation {
+				create_items(input: {title: "graphql", description: "Рассказать про GraphQL"}) { id title updated }
+			}`,
+			Status: http.StatusOK,
+			Body:   `{"data":{"create_items":{"id":3,"title":"graphql","updated":null}}}`,
+		},
+		{
+			Query:     `mutation Update($input: items_input!) { update_items(id: 3, input: $input) { id updated } }`,
+			Variables: CR{"input": CR{"updated": "autoupdate"}},
+			Status:    http.StatusOK,
+			Body:      `{"data":{"update_items":{"id":3,"updated":"autoupdate"}}}`,
+		},
+		{
+			Query:  `mutation { update_items(id: 3, input: {title: null}) { id } }`,
+			Status: http.StatusOK,
+			Body: `{"errors":[{"message":"field title have invalid type","locations":[{"line":1,"column":12}],` +
+				`"path":["update_items"],"extensions":{"status":400}}],"data":{"update_items":null}}`,
+		},
+		{
+			Query:  `mutation { delete_items(id: 3) }`,
+			Status: http.StatusOK,
+			Body:   `{"data":{"delete_items":1}}`,
+		},
+		{
+			Query:  "{\n  items { id name }\n}",
+			Status: http.StatusBadRequest,
+			Body:   `{"errors":[{"message":"Cannot query field \"name\" on type \"items\".","locations":[{"line":2,"column":14}]}]}`,
+		},
+		{
+			Query:  `{ items(limit: "1") { id } }`,
+			Status: http.StatusBadRequest,
+			Body:   `{"errors":[{"message":"Int cannot represent value: \"1\"","locations":[{"line":1,"column":16}]}]}`,
+		},
+		{
+			Query:  `{ items { id }`,
+			Status: http.StatusBadRequest,
+			Body:   `{"errors":[{"message":"Syntax Error: Expected Name, found \u003cEOF\u003e.","locations":[{"line":1,"column":15}]}]}`,
+		},
+		{
+			Method: http.MethodGet,
+			Query:  `mutation { delete_items(id: 1) }`,
+			Status: http.StatusMethodNotAllowed,
+			Body:   `{"errors":[{"message":"Can only perform a mutation operation from a POST request.","locations":[{"line":1,"column":1}]}]}`,
+		},
+		{
+			Method: http.MethodGet,
+			Query:  `{ users { user_id login } }`,
+			Status: http.StatusOK,
+			Body:   `{"data":{"users":[{"user_id":1,"login":"rvasily"}]}}`,
+		},
+	}
+
+	for idx, item := range cases {
+		var req *http.Request
+		if item.Method == http.MethodGet {
+			req, _ = http.NewRequest(http.MethodGet, ts.URL+"/graphql?query="+url.QueryEscape(item.Query), nil)
+		} else {
+			data, _ := json.Marshal(CR{"query": item.Query, "variables": item.Variables})
+			req, _ = http.NewRequest(http.MethodPost, ts.URL+"/graphql", bytes.NewReader(data))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[case %d] request error: %v", idx, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Fatalf("[case %d] expected http status %v, got %v: %s", idx, item.Status, resp.StatusCode, body)
+		}
+		if string(body) != item.Body {
+			t.Fatalf("[case %d] results not match\nGot : %s\nWant: %s", idx, body, item.Body)
+		}
+	}
+
+	resp, err := client.Get(ts.URL + "/graphql")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, expected := range []string{
+		"  items(limit: Int, offset: Int, filter: items_filter, sort: [items_sort!]): [items!]!\n",
+		"  users_by_pk(user_id: Int!): users\n",
+		"  update_items(id: Int!, input: items_input!): items\n",
+		"type items {\n  id: Int!\n  title: String!\n  description: String!\n  updated: String\n}\n",
+	} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Fatalf("schema doesn't contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestGraphQLNameCollisions(t *testing.T) {
+	// таблицы, имена типов которых уже заняты, пропускаются в схеме
+	desc := DbDesc{tables: make(map[string]TableDesc)}
+	for _, name := range []string{"items", "items_filter", "String", "Query", "a-b", "a_b", "__type"} {
+		desc.tables[name] = TableDesc{
+			Name:   name,
+			kind:   tableKindBase,
+			fields: map[string]FieldDesc{"id": FieldDesc{Name: "id", Type: "int", IsPrimaryKey: true}},
+		}
+	}
+	schema := newGraphQLSchema(desc)
+	_, hasAB := schema.columns["a-b"]
+	_, hasItems := schema.columns["items"]
+	if len(schema.columns) != 2 || !hasAB || !hasItems {
+		t.Fatalf("unexpected tables of the schema: %v", schema.columns)
+	}
+	if schema.types[gqlString].kind != gqlKindScalar || schema.types["Query"] != schema.query {
+		t.Fatalf("built-in types are overwritten by tables")
+	}
+	if filter := schema.types["items_filter"]; filter.kind != gqlKindInputObject || filter.inputFields[0].name != "id" {
+		t.Fatalf("the filter of items is overwritten by a table")
+	}
+}
+
+func TestRelations(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	for _, q := range []string{
+		`ALTER TABLE items ADD COLUMN user_id int(11) DEFAULT NULL`,
+		`ALTER TABLE items ADD CONSTRAINT items_user FOREIGN KEY (user_id) REFERENCES users (user_id)`,
+		`UPDATE items SET user_id = 1 WHERE id = 1`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path: "/users/1/items",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+							"user_id":     1,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path: "/items/1/user",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id":  1,
+						"login":    "rvasily",
+						"password": "love",
+						"email":    "rvasily@example.com",
+						"info":     "none",
+						"updated":  nil,
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items/2/user",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/users/100500/items",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/users/1/orders",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown relation",
+			},
+		},
+	})
+
+	data, _ := json.Marshal(CR{"query": `{ users { login items { id } } items { id user { login } } }`})
+	resp, err := client.Post(ts.URL+"/graphql", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	expected := `{"data":{"users":[{"login":"rvasily","items":[{"id":1}]}],` +
+		`"items":[{"id":1,"user":{"login":"rvasily"}},{"id":2,"user":null}]}}`
+	if string(body) != expected {
+		t.Fatalf("results not match\nGot : %s\nWant: %s", body, expected)
+	}
+
+	// связанные записи всех записей уровня читаются вместе, limit и offset действуют на каждую запись
+	for _, q := range []string{
+		`INSERT INTO users (user_id, login, password, email, info) VALUES (2, 'petya', 'qwerty', 'petya@example.com', 'none')`,
+		`UPDATE items SET user_id = 2 WHERE id = 2`,
+		`INSERT INTO items (id, title, description, user_id) VALUES (3, 'graphql', 'Рассказать про GraphQL', 1)`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			panic(err)
+		}
+	}
+	for idx, item := range []struct {
+		Query  string
+		Status int
+		Body   string
+	}{
+		{
+			Query: `{ users(sort: [user_id_ASC]) { login items(limit: 1, sort: [id_DESC]) {
+				id user { login items(offset: 1, sort: [id_ASC]) { id } }
+			} } }`,
+			Status: http.StatusOK,
+			Body: `{"data":{"users":[` +
+				`{"login":"rvasily","items":[{"id":3,"user":{"login":"rvasily","items":[{"id":3}]}}]},` +
+				`{"login":"petya","items":[{"id":2,"user":{"login":"petya","items":[]}}]}]}}`,
+		},
+		{
+			Query:  `{ users { items { user { items { user { items { user { items { id } } } } } } } } }`,
+			Status: http.StatusBadRequest,
+			Body: `{"errors":[{"message":"Field \"items\" exceeds the maximum depth of 8 levels of selections.",` +
+				`"locations":[{"line":1,"column":56}]}]}`,
+		},
+	} {
+		data, _ = json.Marshal(CR{"query": item.Query})
+		resp, err = client.Post(ts.URL+"/graphql", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("[case %d] request error: %v", idx, err)
+		}
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status || string(body) != item.Body {
+			t.Fatalf("[case %d] results not match\nGot : %d %s\nWant: %d %s", idx, resp.StatusCode, body, item.Status, item.Body)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	for _, q := range []string{
+		`ALTER TABLE items ADD COLUMN user_id int(11) DEFAULT NULL`,
+		`ALTER TABLE items ADD CONSTRAINT items_user FOREIGN KEY (user_id) REFERENCES users (user_id)`,
+		`UPDATE items SET user_id = 1 WHERE id = 1`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	user := CR{
+		"user_id":  1,
+		"login":    "rvasily",
+		"password": "love",
+		"email":    "rvasily@example.com",
+		"info":     "none",
+		"updated":  nil,
+	}
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items",
+			Query: "expand=user",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+							"user_id":     1,
+							"user":        user,
+						},
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+							"user_id":     nil,
+							"user":        nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/users/1",
+			Query: "expand=items",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id":  1,
+						"login":    "rvasily",
+						"password": "love",
+						"email":    "rvasily@example.com",
+						"info":     "none",
+						"updated":  nil,
+						"items": []CR{
+							CR{
+								"id":          1,
+								"title":       "database/sql",
+								"description": "Рассказать про базы данных",
+								"updated":     "rvasily",
+								"user_id":     1,
+							},
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "expand=user,orders",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown relation orders",
+			},
+		},
+	})
+
+	resp, err := client.Get(ts.URL + "/_openapi.json")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	var spec CR
+	json.NewDecoder(resp.Body).Decode(&spec)
+	resp.Body.Close()
+	parameters, _ := json.Marshal(spec["paths"].(map[string]interface{})["/items"].(map[string]interface{})["get"].(map[string]interface{})["parameters"])
+	if !bytes.Contains(parameters, []byte(`"name":"expand"`)) || !bytes.Contains(parameters, []byte(`"enum":["user"]`)) {
+		t.Fatalf("the expand parameter of items is missing in the OpenAPI document: %s", parameters)
+	}
+
+	// дочерние записи каждой записи ограничены maxLimit
+	_, err = db.Exec(`UPDATE items SET user_id = 1 WHERE id = 2`)
+	if err != nil {
+		panic(err)
+	}
+	limitedHandler, err := NewDbExplorer(db, WithMaxLimit(1))
+	if err != nil {
+		panic(err)
+	}
+	limitedTs := httptest.NewServer(limitedHandler)
+	runCases(t, limitedTs, db, []Case{
+		Case{
+			Path:  "/users",
+			Query: "expand=items",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id":  1,
+							"login":    "rvasily",
+							"password": "love",
+							"email":    "rvasily@example.com",
+							"info":     "none",
+							"updated":  nil,
+							"items": []CR{
+								CR{
+									"id":          1,
+									"title":       "database/sql",
+									"description": "Рассказать про базы данных",
+									"updated":     "rvasily",
+									"user_id":     1,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestAggregate(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items/_aggregate",
+			Query: "group_by=updated&count=*&max=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"updated": nil, "count": 1, "max_id": 2},
+						CR{"updated": "rvasily", "count": 1, "max_id": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items/_aggregate",
+			Query: "sum=id&avg=id&min=title",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"sum_id": 3, "avg_id": 1.5, "min_title": "database/sql"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items/_aggregate",
+			Query:  "sum=title",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "sum of non-numeric column title",
+			},
+		},
+		Case{
+			Path:   "/items/_aggregate",
+			Query:  "group_by=author&count=*",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown column author",
+			},
+		},
+		Case{
+			// у двух агрегатов одно имя в результате
+			Path:   "/items/_aggregate",
+			Query:  "group_by=updated&max=id&max=id",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "duplicate name of aggregates max_id",
+			},
+		},
+		Case{
+			Path:   "/items/_aggregate",
+			Query:  "group_by=updated",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "no aggregates",
+			},
+		},
+		Case{
+			Path:   "/unknown_table/_aggregate",
+			Query:  "count=*",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+	})
+}
+
+func TestSearch(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items",
+			Query: "q=memcache&score=true",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+							"_score":      1,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "q=Рассказать+про&highlight=true",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+							"_highlights": CR{
+								"description": "<em>Рассказать</em> <em>про</em> базы данных",
+							},
+						},
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+							"_highlights": CR{
+								"description": "<em>Рассказать</em> <em>про</em> мемкеш с примером использ…",
+							},
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "q=100%25",
+			Result: CR{
+				"response": CR{
+					"records": []CR{},
+				},
+			},
+		},
+		Case{
+			Path:  "/items/_aggregate",
+			Query: "q=memcache&count=*",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"count": 1},
+					},
+				},
+			},
+		},
+	})
+
+	// с FULLTEXT индексом строки ищутся через MATCH ... AGAINST и сортируются по сумме оценок
+	_, err = db.Exec(`INSERT INTO items (id, title, description, updated) VALUES
+		(3, 'memcache vs memcache', '', NULL),
+		(4, 'redis', 'memcache', NULL)`)
+	if err != nil {
+		panic(err)
+	}
+	_, err = db.Exec(`ALTER TABLE items ADD FULLTEXT INDEX items_text (title)`)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Exec(`ALTER TABLE items DROP INDEX items_text`)
+	desc, err := initExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	//the index is described here as information_schema.STATISTICS of MySQL would describe it
+	items := desc.tables["items"]
+	if len(items.fullTextIndexes) == 0 {
+		items.fullTextIndexes = [][]string{{"title"}}
+		desc.tables["items"] = items
+	}
+	ftTs := httptest.NewServer(NewRouter(db, *desc))
+
+	// в отличие от LIKE, MATCH ищет только в колонках индекса, строка 4 не находится
+	resp, err := client.Get(ftTs.URL + "/items?q=memcache&score=true")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	var found struct {
+		Response struct {
+			Records []struct {
+				ID    int     `json:"id"`
+				Score float64 `json:"_score"`
+			} `json:"records"`
+		} `json:"response"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&found)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+	records := found.Response.Records
+	if len(records) != 2 || records[0].ID != 3 || records[1].ID != 2 {
+		t.Fatalf("expected items 3 and 2, got %+v", records)
+	}
+	if records[1].Score <= 0 || records[0].Score <= records[1].Score {
+		t.Fatalf("items aren't ordered by scores: %+v", records)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	filter := func(expression string) string {
+		return "filter=" + url.QueryEscape(expression)
+	}
+	item := func(id int) CR {
+		items := []CR{
+			CR{
+				"id":          1,
+				"title":       "database/sql",
+				"description": "Рассказать про базы данных",
+				"updated":     "rvasily",
+			},
+			CR{
+				"id":          2,
+				"title":       "memcache",
+				"description": "Рассказать про мемкеш с примером использования",
+				"updated":     nil,
+			},
+		}
+		return items[id-1]
+	}
+	nested := ""
+	for i := 0; i <= maxFilterDepth; i++ {
+		nested = "(" + nested + ")"
+	}
+	nested = nested[:maxFilterDepth+1] + "id==1" + nested[maxFilterDepth+1:]
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/users",
+			Query: filter("(login==rvasily or email=like=*@example.com) and updated=isnull=true"),
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id":  1,
+							"login":    "rvasily",
+							"password": "love",
+							"email":    "rvasily@example.com",
+							"info":     "none",
+							"updated":  nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: filter("id=in=(1,2);not title=='memcache'"),
+			Result: CR{
+				"response": CR{
+					"records": []CR{item(1)},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: filter("id>1,updated==nobody"),
+			Result: CR{
+				"response": CR{
+					"records": []CR{item(2)},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  filter("(id==1"),
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid filter: expected ')' instead of end of filter at position 7",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  filter("id==1 and author==rvasily"),
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid filter: unknown column author at position 11",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  filter("id==abc"),
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid filter: invalid value 'abc' of column id at position 5",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  filter(nested),
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid filter: filter is nested deeper than 20 at position 21",
+			},
+		},
+		Case{
+			Path:  "/items/_aggregate",
+			Query: "count=*&" + filter("updated=isnull=false"),
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"count": 1},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestFacets(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
 
-		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
 
-		// если у вас случилась это ошибка - значит вы не делаете где-то rows.Close и у вас текут соединения с базой
-		// если такое случилось на первом тесте - значит вы не закрываете коннект где-то при иницаилизации в NewDbExplorer
-		if db.Stats().OpenConnections != 1 {
-			t.Fatalf("[%s] you have %d open connections, must be 1", caseName, db.Stats().OpenConnections)
+	_, err = db.Exec(`INSERT INTO items (id, title, description, updated) VALUES (3, 'redis', '', 'rvasily')`)
+	if err != nil {
+		panic(err)
+	}
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path: "/items/_distinct/updated",
+			Result: CR{
+				"response": CR{
+					"values": []interface{}{nil, "rvasily"},
+				},
+			},
+		},
+		Case{
+			Path:  "/items/_distinct/title",
+			Query: "filter=updated==rvasily",
+			Result: CR{
+				"response": CR{
+					"values": []interface{}{"database/sql", "redis"},
+				},
+			},
+		},
+		Case{
+			Path:   "/items/_distinct/author",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown column",
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "limit=1&facets=updated,id&facet_size=1&filter=id>1",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+						},
+					},
+					"facets": CR{
+						"updated": []CR{
+							CR{"value": nil, "count": 1},
+						},
+						"id": []CR{
+							CR{"value": 2, "count": 1},
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "facets=author",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown column author",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "facets=updated&format=ndjson",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "facets aren't supported by the format",
+			},
+		},
+	})
+
+	// колонка с именем count не путается с количеством строк значения
+	_, err = db.Exec("ALTER TABLE items ADD COLUMN `count` int NOT NULL DEFAULT 5")
+	if err != nil {
+		panic(err)
+	}
+	_, err = db.Exec("UPDATE items SET `count` = 7 WHERE id = 3")
+	if err != nil {
+		panic(err)
+	}
+	handler, err = NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	ts = httptest.NewServer(handler)
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:  "/items",
+			Query: "limit=0&facets=count",
+			Result: CR{
+				"response": CR{
+					"records": []CR{},
+					"facets": CR{
+						"count": []CR{
+							CR{"value": 5, "count": 2},
+							CR{"value": 7, "count": 1},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestSample(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	//ids are sparse so some random keys miss rows
+	for id := 3; id <= 40; id += 3 {
+		_, err = db.Exec(`INSERT INTO items (id, title, description, updated) VALUES (?, ?, '', NULL)`, id, fmt.Sprint("item ", id))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	sampleIds := func(query string) []int {
+		resp, err := client.Get(ts.URL + "/items?" + query)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		var answer struct {
+			Response struct {
+				Records []struct {
+					ID int `json:"id"`
+				} `json:"records"`
+			} `json:"response"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&answer)
+		if err != nil {
+			t.Fatalf("bad answer to %s: %v", query, err)
+		}
+		ids := make([]int, len(answer.Response.Records))
+		for i, record := range answer.Response.Records {
+			ids[i] = record.ID
+		}
+		return ids
+	}
+
+	ids := sampleIds("sample=5&seed=42")
+	if len(ids) != 5 {
+		t.Fatalf("expected 5 sampled rows, got %v", ids)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("sampled rows aren't ordered by key: %v", ids)
+		}
+	}
+	if again := sampleIds("sample=5&seed=42"); !reflect.DeepEqual(ids, again) {
+		t.Fatalf("samples with the same seed differ: %v and %v", ids, again)
+	}
+	if all := sampleIds("sample=100"); len(all) != 15 {
+		t.Fatalf("expected all 15 rows, got %v", all)
+	}
+	if half := sampleIds("sample_pct=20&seed=1"); len(half) != 3 {
+		t.Fatalf("expected 3 rows of 20%%, got %v", half)
+	}
+	if filtered := sampleIds("sample=2&seed=3&" + url.Values{"filter": {"id<3"}}.Encode()); !reflect.DeepEqual(filtered, []int{1, 2}) {
+		t.Fatalf("expected both filtered rows, got %v", filtered)
+	}
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/items",
+			Query:  "sample=5&sample_pct=10",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "sample and sample_pct can't be used together",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "sample=0",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "sample must be a positive integer",
+			},
+		},
+	})
+}
+
+func TestReload(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+	defer db.Exec(`DROP TABLE IF EXISTS tags`)
+
+	//the poll runs along with requests so it has its own connections
+	pollDb, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	defer pollDb.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pollHandler, err := NewDbExplorer(pollDb, WithSchemaPolling(ctx, 10*time.Millisecond))
+	if err != nil {
+		panic(err)
+	}
+	pollTs := httptest.NewServer(pollHandler)
+	defer pollTs.Close()
+
+	_, err = db.Exec(`ALTER TABLE items ADD COLUMN views int(11) NOT NULL DEFAULT 0`)
+	if err != nil {
+		panic(err)
+	}
+	//the poll notices the new column
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Get(pollTs.URL + "/items/1")
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if bytes.Contains(body, []byte(`"views":0`)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("schema isn't reloaded by polling: %s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	handler, err := NewDbExplorer(db, WithAdminToken("secret"))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	_, err = db.Exec(`CREATE TABLE tags (id int(11) NOT NULL AUTO_INCREMENT, name varchar(255) NOT NULL, PRIMARY KEY (id))`)
+	if err != nil {
+		panic(err)
+	}
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/tags",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+		Case{
+			Path:   "/_admin/reload",
+			Token:  "secret",
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "Method not allowed",
+			},
+		},
+		Case{
+			Path:   "/tags",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+		Case{
+			Method: http.MethodPost,
+			Path:   "/_admin/reload",
+			Token:  "secret",
+			Result: CR{
+				"response": CR{
+					"tables": []string{"items", "tags", "users"},
+				},
+			},
+		},
+		Case{
+			Path: "/tags",
+			Result: CR{
+				"response": CR{
+					"records": []CR{},
+				},
+			},
+		},
+	})
+}
+
+func TestAdminSchemaChanges(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+	defer db.Exec(`DROP TABLE IF EXISTS tags`)
+
+	handler, err := NewDbExplorer(db, WithAdminToken("secret"))
+	if err != nil {
+		panic(err)
+	}
+	ts := httptest.NewServer(handler)
+
+	disabledHandler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	disabledTs := httptest.NewServer(disabledHandler)
+
+	request := func(baseURL string, method string, path string, token string, body string) (int, CR) {
+		req, _ := http.NewRequest(method, baseURL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		var result CR
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+	expect := func(status int, result CR, wantStatus int, wantError string) {
+		t.Helper()
+		if status != wantStatus || (wantError != "" && result["error"] != wantError) {
+			t.Fatalf("expected %d %q, got %d %v", wantStatus, wantError, status, result)
+		}
+	}
+
+	tags := `{"name": "tags", "columns": [
+		{"name": "id", "type": "int", "primary_key": true, "auto_increment": true},
+		{"name": "name", "type": "VARCHAR(64)", "default": ""}
+	]}`
+
+	status, result := request(disabledTs.URL, http.MethodPost, "/_admin/tables", "", tags)
+	expect(status, result, http.StatusForbidden, "admin endpoints are disabled")
+	status, result = request(disabledTs.URL, http.MethodPost, "/_admin/reload", "", "")
+	expect(status, result, http.StatusForbidden, "admin endpoints are disabled")
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tables", "wrong", tags)
+	expect(status, result, http.StatusUnauthorized, "unauthorized")
+
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tables", "secret", tags)
+	expect(status, result, http.StatusCreated, "")
+	properties, _ := result["properties"].(map[string]interface{})
+	if result["title"] != "tags" || properties["name"] == nil || properties["id"] == nil {
+		t.Fatalf("unexpected schema of the created table: %v", result)
+	}
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tables", "secret", tags)
+	expect(status, result, http.StatusConflict, "table already exists")
+
+	status, result = request(ts.URL, http.MethodPut, "/tags/", "", `{"name": "go"}`)
+	expect(status, result, http.StatusOK, "")
+
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tags/columns", "secret", `{"name": "views", "type": "int unsigned", "default": 0}`)
+	expect(status, result, http.StatusOK, "")
+	status, result = request(ts.URL, http.MethodGet, "/tags/1", "", "")
+	expect(status, result, http.StatusOK, "")
+	if !reflect.DeepEqual(result, CR{"response": map[string]interface{}{"record": map[string]interface{}{"id": float64(1), "name": "go", "views": float64(0)}}}) {
+		t.Fatalf("unexpected record with the added column: %v", result)
+	}
+
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tags/columns", "secret", `{"name": "views", "type": "int"}`)
+	expect(status, result, http.StatusConflict, "column already exists")
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tags/columns", "secret", `{"name": "bad name", "type": "int"}`)
+	expect(status, result, http.StatusBadRequest, `invalid column name "bad name"`)
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tags/columns", "secret", `{"name": "size", "type": "int; DROP TABLE users"}`)
+	expect(status, result, http.StatusBadRequest, `unsupported type "int; DROP TABLE users" of column size`)
+	status, result = request(ts.URL, http.MethodPost, "/_admin/tags/columns", "secret", `{"name": "size", "type": "int", "unknown": 1}`)
+	expect(status, result, http.StatusBadRequest, `can't parse a definition: json: unknown field "unknown"`)
+
+	status, result = request(ts.URL, http.MethodDelete, "/_admin/tags/columns/id", "secret", "")
+	expect(status, result, http.StatusConflict, "the primary key can't be dropped")
+	status, result = request(ts.URL, http.MethodDelete, "/_admin/tags/columns/views", "secret", "")
+	expect(status, result, http.StatusOK, "")
+	properties, _ = result["properties"].(map[string]interface{})
+	if properties["views"] != nil {
+		t.Fatalf("dropped column is in the schema: %v", result)
+	}
+
+	status, result = request(ts.URL, http.MethodDelete, "/_admin/tables/tags", "secret", "")
+	expect(status, result, http.StatusOK, "")
+	status, result = request(ts.URL, http.MethodGet, "/tags", "", "")
+	expect(status, result, http.StatusNotFound, "unknown table")
+}
+
+func TestSchemaDiff(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	_, err = db.Exec(`CREATE INDEX items_title ON items (title)`)
+	if err != nil {
+		panic(err)
+	}
+	_, err = db.Exec(`CREATE DATABASE IF NOT EXISTS golang2017_diff`)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Exec(`DROP DATABASE IF EXISTS golang2017_diff`)
+	againstDSN := strings.Replace(DSN, "/golang2017?", "/golang2017_diff?", 1)
+	againstDb, err := sql.Open("mysql", againstDSN)
+	if err != nil {
+		panic(err)
+	}
+	defer againstDb.Close()
+	for _, q := range []string{
+		`CREATE TABLE items (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  title varchar(100) NOT NULL,
+  description text,
+  updated varchar(255) DEFAULT NULL,
+  legacy int(11) NOT NULL,
+  PRIMARY KEY (id),
+  INDEX items_legacy (legacy)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8`,
+		`CREATE TABLE legacy (id int(11) NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8`,
+	} {
+		_, err = againstDb.Exec(q)
+		if err != nil {
+			panic(err)
 		}
+	}
 
-		if item.Method == "" || item.Method == http.MethodGet {
-			req, err = http.NewRequest(item.Method, ts.URL+item.Path+"?"+item.Query, nil)
-		} else {
-			data, err := json.Marshal(item.Body)
-			if err != nil {
-				panic(err)
-			}
-			reqBody := bytes.NewReader(data)
-			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
-			req.Header.Add("Content-Type", "application/json")
-		}
+	handler, err := NewDbExplorer(db, WithDiffTarget("staging", againstDb), WithAdminToken("secret"))
+	if err != nil {
+		panic(err)
+	}
+	ts := httptest.NewServer(handler)
 
+	diff := func(query string, wantStatus int) CR {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/_admin/diff"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
 		resp, err := client.Do(req)
 		if err != nil {
-			t.Fatalf("[%s] request error: %v", caseName, err)
-			continue
+			t.Fatalf("request error: %v", err)
 		}
 		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
+		var result CR
+		json.NewDecoder(resp.Body).Decode(&result)
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("expected %d, got %d %v", wantStatus, resp.StatusCode, result)
+		}
+		return result
+	}
 
-		// fmt.Printf("[%s] body: %s\n", caseName, string(body))
-		if item.Status == 0 {
-			item.Status = http.StatusOK
+	result := diff("", http.StatusBadRequest)
+	if result["error"] != "against is required" {
+		t.Fatalf("unexpected error: %v", result)
+	}
+	result = diff("?against=production", http.StatusNotFound)
+	if result["error"] != "unknown database" {
+		t.Fatalf("unexpected error: %v", result)
+	}
+
+	result = diff("?against=staging", http.StatusOK)
+	changes := result["response"].(map[string]interface{})["changes"].([]interface{})
+	var descriptions []string
+	for _, change := range changes {
+		descriptions = append(descriptions, change.(map[string]interface{})["description"].(string))
+	}
+	titleType, descriptionType := "", ""
+	for _, field := range getFieldsOf(t, db, "items") {
+		switch field.Name {
+		case "title":
+			titleType = field.RawType
+		case "description":
+			descriptionType = field.RawType
+		}
+	}
+	againstTitleType := ""
+	for _, field := range getFieldsOf(t, againstDb, "items") {
+		if field.Name == "title" {
+			againstTitleType = field.RawType
 		}
+	}
+	expected := []string{
+		"drop index items_legacy of items",
+		"change column items.title from " + againstTitleType + " NOT NULL to " + titleType + " NOT NULL",
+		"change column items.description from " + descriptionType + " NULL to " + descriptionType + " NOT NULL",
+		"drop column items.legacy",
+		"add index items_title of items",
+		"drop table legacy",
+		"create table users",
+	}
+	if !reflect.DeepEqual(descriptions, expected) {
+		t.Fatalf("unexpected changes:\n%#v\nexpected:\n%#v", descriptions, expected)
+	}
 
-		if resp.StatusCode != item.Status {
-			t.Fatalf("[%s] expected http status %v, got %v", caseName, item.Status, resp.StatusCode)
-			continue
+	//statements of the changes make the schemas the same
+	for _, change := range changes {
+		statement := change.(map[string]interface{})["statement"].(string)
+		_, err = againstDb.Exec(statement)
+		if err != nil {
+			t.Fatalf("can't apply %s: %v", statement, err)
 		}
+	}
+	var out bytes.Buffer
+	err = runCommand(db, []string{"diff", againstDSN}, nil, &out)
+	if err != nil {
+		t.Fatalf("diff command error: %v", err)
+	}
+	if out.String() != "-- schemas are the same\n" {
+		t.Fatalf("schemas differ after applying changes:\n%s", out.String())
+	}
+}
 
-		err = json.Unmarshal(body, &result)
+func getFieldsOf(t *testing.T, db *sql.DB, table string) map[string]FieldDesc {
+	fields, err := getFields(db, table)
+	if err != nil {
+		t.Fatalf("can't get fields of %s: %v", table, err)
+	}
+	return fields
+}
+
+func TestMigrations(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS tags`)
+	defer db.Exec(`DROP TABLE IF EXISTS schema_migrations`)
+
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"0001_create_tags.up.sql": `CREATE TABLE tags (
+  id int NOT NULL AUTO_INCREMENT,
+  name varchar(64) NOT NULL,
+  PRIMARY KEY (id)
+);
+INSERT INTO tags (name) VALUES ('go');`,
+		"0001_create_tags.down.sql":   `DROP TABLE tags;`,
+		"0002_add_tag_views.up.sql":   `ALTER TABLE tags ADD COLUMN views int NOT NULL DEFAULT 0;`,
+		"0002_add_tag_views.down.sql": `ALTER TABLE tags DROP COLUMN views;`,
+		"README.md":                   `not a migration`,
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
 		if err != nil {
-			t.Fatalf("[%s] cant unpack json: %v", caseName, err)
-			continue
+			panic(err)
 		}
+	}
 
-		// reflect.DeepEqual не работает если нам приходят разные типы
-		// а там приходят разные типы (string VS interface{}) по сравнению с тем что в ожидаемом результате
-		// этот маленький грязный хак конвертит данные сначала в json, а потом обратно в interface - получаем совместимые результаты
-		// не используйте это в продакшен-коде - надо явно писать что ожидается интерфейс или использовать другой подход с точным форматом ответа
-		data, err := json.Marshal(item.Result)
-		json.Unmarshal(data, &expected)
+	migrate := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runCommand(db, append([]string{"migrate", "-dir", dir}, args...), nil, &out)
+		return out.String(), err
+	}
+	expectOutput := func(want string, args ...string) {
+		t.Helper()
+		out, err := migrate(args...)
+		if err != nil || out != want {
+			t.Fatalf("migrate %v: expected %q, got %q, %v", args, want, out, err)
+		}
+	}
 
-		if !reflect.DeepEqual(result, expected) {
-			t.Fatalf("[%s] results not match\nGot : %#v\nWant: %#v", caseName, result, expected)
-			continue
+	expectOutput("1 create_tags: pending\n2 add_tag_views: pending\n", "status")
+	// статус только читает и не создаёт таблицу применённых миграций
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'schema_migrations'`).Scan(&tables)
+	if err != nil || tables != 0 {
+		t.Fatalf("status created the table of applied migrations: %d, %v", tables, err)
+	}
+	expectOutput("applied 1 create_tags\n", "to", "1")
+	expectOutput("no migrations to run\n", "to", "1")
+
+	handler, err := NewDbExplorer(db, WithMigrations(dir), WithAdminToken("secret"))
+	if err != nil {
+		panic(err)
+	}
+	ts := httptest.NewServer(handler)
+	request := func(method string, path string, wantStatus int) CR {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		var result CR
+		json.NewDecoder(resp.Body).Decode(&result)
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("expected %d, got %d %v", wantStatus, resp.StatusCode, result)
 		}
+		return result
+	}
+
+	result := request(http.MethodGet, "/_admin/migrations", http.StatusOK)
+	migrations := result["response"].(map[string]interface{})["migrations"].([]interface{})
+	if len(migrations) != 2 || migrations[0].(map[string]interface{})["applied_at"] == nil ||
+		migrations[1].(map[string]interface{})["applied_at"] != nil {
+		t.Fatalf("unexpected status of migrations: %v", result)
+	}
+
+	result = request(http.MethodPost, "/_admin/migrations/to/7", http.StatusBadRequest)
+	if result["error"] != "unknown version 7" {
+		t.Fatalf("unexpected error: %v", result)
+	}
+	result = request(http.MethodPost, "/_admin/migrations/up", http.StatusOK)
+	if !reflect.DeepEqual(result, CR{"response": map[string]interface{}{"steps": []interface{}{"applied 2 add_tag_views"}}}) {
+		t.Fatalf("unexpected steps: %v", result)
+	}
+	//the schema is reloaded after migrations
+	result = request(http.MethodGet, "/tags/1", http.StatusOK)
+	if !reflect.DeepEqual(result, CR{"response": map[string]interface{}{"record": map[string]interface{}{"id": float64(1), "name": "go", "views": float64(0)}}}) {
+		t.Fatalf("unexpected record: %v", result)
+	}
+	// строки применённых миграций меняются только миграциями
+	result = request(http.MethodGet, "/", http.StatusOK)
+	if result["response"].(map[string]interface{})["read_only"].(map[string]interface{})["schema_migrations"] != "migrations table" {
+		t.Fatalf("the table of applied migrations isn't read-only: %v", result)
+	}
+	result = request(http.MethodDelete, "/schema_migrations/1", http.StatusMethodNotAllowed)
+	if result["error"] != "migrations table is read-only" {
+		t.Fatalf("unexpected error: %v", result)
+	}
+
+	// миграции не прерываются, когда клиент уходит
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	migrationsCtx, cancelMigrations := (&Router{}).migrationsContext(httptest.NewRequest(http.MethodPost, "/_admin/migrations/up", nil).WithContext(canceled))
+	defer cancelMigrations()
+	if _, ok := migrationsCtx.Deadline(); migrationsCtx.Err() != nil || !ok {
+		t.Fatalf("migrations run on a canceled context or without a timeout: %v", migrationsCtx.Err())
+	}
+
+	//migrations don't run while another instance holds the lock
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		panic(err)
+	}
+	_, err = conn.ExecContext(ctx, "SELECT GET_LOCK(?, 0)", migrationLockName)
+	if err != nil {
+		panic(err)
+	}
+	err = withMigrationLock(ctx, db, 0, func(conn *sql.Conn) error {
+		return nil
+	})
+	if _, ok := err.(migrationLockError); !ok {
+		t.Fatalf("expected migrationLockError, got %v", err)
+	}
+	conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLockName)
+	conn.Close()
+
+	expectOutput("reverted 2 add_tag_views\n", "down")
+	expectOutput("reverted 1 create_tags\n", "down")
+	if _, err = migrate("down"); err == nil || err.Error() != "no migrations are applied" {
+		t.Fatalf("unexpected error of down without applied migrations: %v", err)
+	}
+	expectOutput("applied 1 create_tags\napplied 2 add_tag_views\n", "up")
+	expectOutput("reverted 2 add_tag_views\nreverted 1 create_tags\n", "to", "0")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "3_broken.sql"), nil, 0644)
+	if err != nil {
+		panic(err)
+	}
+	if _, err = migrate("up"); err == nil || err.Error() != "invalid name of migration file 3_broken.sql" {
+		t.Fatalf("unexpected error of an invalid file name: %v", err)
+	}
+}
+
+func TestReadOnlyViews(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+	_, err = db.Exec(`CREATE VIEW item_titles AS SELECT id, title FROM items`)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Exec(`DROP VIEW IF EXISTS item_titles`)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path: "/",
+			Result: CR{
+				"response": CR{
+					"tables":    []string{"item_titles", "items", "users"},
+					"read_only": CR{"item_titles": "view"},
+				},
+			},
+		},
+		Case{
+			Path:  "/item_titles",
+			Query: "limit=1",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1, "title": "database/sql"},
+					},
+				},
+			},
+		},
+		Case{
+			// у представления нет первичного ключа, строку по id не найти
+			Path:   "/item_titles/1",
+			Status: http.StatusNotFound,
+			Result: CR{"error": "no primary key"},
+		},
+		Case{
+			// id ресурса без первичного ключа собирается из значений строки
+			Path:   "/item_titles",
+			Query:  "limit=1",
+			Accept: "application/vnd.api+json",
+			Result: CR{
+				"data": []CR{
+					CR{
+						"type":       "item_titles",
+						"id":         `[1,"database/sql"]`,
+						"attributes": CR{"id": 1, "title": "database/sql"},
+					},
+				},
+				"links": CR{
+					"self":  "/item_titles?limit=1&offset=0",
+					"first": "/item_titles?limit=1&offset=0",
+					"next":  "/item_titles?limit=1&offset=1",
+				},
+			},
+		},
+		Case{
+			Path:   "/item_titles/",
+			Method: http.MethodPut,
+			Body:   CR{"title": "new"},
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{"error": "view is read-only"},
+		},
+		Case{
+			Path:   "/item_titles/1",
+			Method: http.MethodPost,
+			Body:   CR{"title": "new"},
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{"error": "view is read-only"},
+		},
+		Case{
+			Path:   "/item_titles/_import",
+			Method: http.MethodPost,
+			Body:   CR{"title": "new"},
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{"error": "view is read-only"},
+		},
+		Case{
+			Path:   "/item_titles/1",
+			Method: http.MethodDelete,
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{"error": "view is read-only"},
+		},
+	}
+	runCases(t, ts, db, cases)
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/item_titles/1", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if allow := resp.Header.Get("Allow"); allow != http.MethodGet {
+		t.Fatalf("expected Allow: GET, got %q", allow)
+	}
+
+	resp, err = client.Get(ts.URL + "/_openapi.json")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+	var spec CR
+	json.NewDecoder(resp.Body).Decode(&spec)
+	paths := spec["paths"].(map[string]interface{})
+	if _, ok := paths["/item_titles"].(map[string]interface{})["put"]; ok {
+		t.Fatalf("writes of a view are in the OpenAPI document")
+	}
+	if _, ok := paths["/items"].(map[string]interface{})["put"]; !ok {
+		t.Fatalf("writes of a table are missing in the OpenAPI document")
+	}
+
+	// представление попадает в дамп после таблиц и без строк
+	adminHandler, err := NewDbExplorer(db, WithAdminToken("secret"))
+	if err != nil {
+		panic(err)
+	}
+	adminTs := httptest.NewServer(adminHandler)
+	req, _ = http.NewRequest(http.MethodGet, adminTs.URL+"/_dump", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	dumpResp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	dump, _ := ioutil.ReadAll(dumpResp.Body)
+	dumpResp.Body.Close()
+	viewAt := bytes.Index(dump, []byte("DROP VIEW IF EXISTS `item_titles`;\nCREATE VIEW `item_titles`"))
+	if viewAt < 0 || viewAt < bytes.Index(dump, []byte("CREATE TABLE `users`")) {
+		t.Fatalf("the view isn't dumped after the tables:\n%s", dump)
+	}
+	if bytes.Contains(dump, []byte("DROP TABLE IF EXISTS `item_titles`")) || bytes.Contains(dump, []byte("INSERT INTO `item_titles`")) {
+		t.Fatalf("the view is dumped like a table:\n%s", dump)
+	}
+}
+
+func TestRPC(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+	_, err = db.Exec(`CREATE PROCEDURE count_items(IN min_id INT, IN label VARCHAR(32), OUT total INT, INOUT calls INT)
+BEGIN
+	SET total = (SELECT COUNT(*) FROM items WHERE id >= min_id);
+	SET calls = calls + 1;
+	SELECT id, title FROM items WHERE id >= min_id ORDER BY id;
+END`)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Exec(`DROP PROCEDURE IF EXISTS count_items`)
+	// процедура падает после первого набора строк, частичный ответ не отдаётся
+	_, err = db.Exec(`CREATE PROCEDURE failing_items()
+BEGIN
+	SELECT id FROM items;
+	SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'failed after a select';
+END`)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Exec(`DROP PROCEDURE IF EXISTS failing_items`)
+
+	desc, err := initExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	//parameters are described here as information_schema.PARAMETERS would describe them
+	desc.routines["count_items"] = routineDesc{
+		name: "count_items",
+		kind: "PROCEDURE",
+		params: []routineParam{
+			{mode: "IN", field: routineField("min_id", "int", "int")},
+			{mode: "IN", field: routineField("label", "varchar", "varchar(32)")},
+			{mode: "OUT", field: routineField("total", "int", "int")},
+			{mode: "INOUT", field: routineField("calls", "int", "int")},
+		},
 	}
+	desc.routines["failing_items"] = routineDesc{name: "failing_items", kind: "PROCEDURE"}
+	ts := httptest.NewServer(NewRouter(db, *desc))
 
+	cases := []Case{
+		Case{
+			Path:   "/_rpc/failing_items",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusInternalServerError,
+			Result: CR{"error": "Internal Server Error"},
+		},
+		Case{
+			Path:   "/_rpc/count_items",
+			Method: http.MethodPost,
+			Body:   CR{"min_id": 2, "label": "x", "calls": 5},
+			Result: CR{
+				"response": CR{
+					"result_sets": []interface{}{
+						[]CR{
+							CR{"id": 2, "title": "memcache"},
+						},
+					},
+					"out": CR{"total": 1, "calls": 6},
+				},
+			},
+		},
+		Case{
+			Path:   "/_rpc/count_items",
+			Method: http.MethodPost,
+			Body:   CR{"min_id": "two", "label": "x", "calls": 5},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "field min_id have invalid type"},
+		},
+		Case{
+			Path:   "/_rpc/count_items",
+			Method: http.MethodPost,
+			Body:   CR{"label": "x", "calls": 5},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "parameter min_id is required"},
+		},
+		Case{
+			Path:   "/_rpc/count_items",
+			Method: http.MethodPost,
+			Body:   CR{"min_id": 1, "label": "x", "calls": 5, "total": 1},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "parameter total is OUT"},
+		},
+		Case{
+			Path:   "/_rpc/count_items",
+			Method: http.MethodPost,
+			Body:   CR{"min_id": 1, "label": "x", "calls": 5, "extra": 1},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "unknown parameter extra"},
+		},
+		Case{
+			Path:        "/_rpc/count_items",
+			Method:      http.MethodPost,
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        CR{"min_id": "2", "label": "x", "calls": "5"},
+			Result: CR{
+				"response": CR{
+					"result_sets": []interface{}{
+						[]CR{
+							CR{"id": 2, "title": "memcache"},
+						},
+					},
+					"out": CR{"total": 1, "calls": 6},
+				},
+			},
+		},
+		Case{
+			Path:   "/_rpc/drop_everything",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusNotFound,
+			Result: CR{"error": "unknown procedure"},
+		},
+	}
+	runCases(t, ts, db, cases)
 }
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//migrationsTable keeps versions of applied migrations
+	migrationsTable = "schema_migrations"
+	//migrationLockName is a name of the lock of GET_LOCK held while migrations run
+	//so two instances don't run them concurrently
+	migrationLockName = "db_explorer_migrations"
+	//migrationLockTimeout is a number of seconds to wait for the lock
+	migrationLockTimeout = 10
+	//migrationsTimeout limits time of migrations run by a request if the route has no timeout
+	migrationsTimeout = 10 * time.Minute
+)
+
+//migration is a version of the schema changed by statements of the up file
+//and reverted by the down one, like 0002_add_tags.up.sql and 0002_add_tags.down.sql
+type migration struct {
+	version int
+	name    string
+	//up and down are paths of files, down is empty if the migration can't be reverted
+	up   string
+	down string
+}
+
+func (m migration) String() string {
+	return fmt.Sprintf("%d %s", m.version, m.name)
+}
+
+//migrationError is an error of migrations or their files
+type migrationError struct {
+	message string
+}
+
+func (mErr migrationError) Error() string {
+	return mErr.message
+}
+
+//migrationLockError is returned if migrations are run by another instance
+type migrationLockError struct{}
+
+func (migrationLockError) Error() string {
+	return "migrations are run by another instance"
+}
+
+//migrationStepError is an error of a statement of a migration
+type migrationStepError struct {
+	migration migration
+	statement int
+	err       error
+}
+
+func (sErr migrationStepError) Error() string {
+	return fmt.Sprintf("migration %s: statement %d: %s", sErr.migration, sErr.statement, sErr.err.Error())
+}
+
+func (sErr migrationStepError) Unwrap() error {
+	return sErr.err
+}
+
+//loadMigrations reads migrations of the directory ordered by their versions,
+//files are named by a version, a name and a direction like 0001_create_tags.up.sql
+func loadMigrations(dir string) ([]migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(file.Name(), ".sql")
+		direction := filepath.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if (direction != ".up" && direction != ".down") || len(parts) != 2 || err != nil || version <= 0 {
+			return nil, migrationError{"invalid name of migration file " + file.Name()}
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[1]}
+			byVersion[version] = m
+		}
+		if m.name != parts[1] {
+			return nil, migrationError{fmt.Sprintf("migrations %s and %s have the same version", m, base)}
+		}
+		path := filepath.Join(dir, file.Name())
+		if direction == ".up" {
+			m.up = path
+		} else {
+			m.down = path
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, migrationError{"migration " + m.String() + " has no up file"}
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+//withMigrationLock calls fn with a connection holding the lock of migrations,
+//migrationLockError is returned if the lock isn't got in timeout seconds
+func withMigrationLock(ctx context.Context, db *sql.DB, timeout int, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, timeout).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return migrationLockError{}
+	}
+	defer func() {
+		//the lock is released even if ctx is done
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName)
+		if err != nil {
+			log.Println("can't release the lock of migrations:", err)
+		}
+	}()
+	return fn(conn)
+}
+
+//createMigrationsTable creates the table of applied migrations if it's missing
+func createMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+quoteIdentifier(migrationsTable)+` (
+  version bigint NOT NULL,
+  name varchar(255) NOT NULL,
+  applied_at datetime NOT NULL,
+  PRIMARY KEY (version)
+)`)
+	return err
+}
+
+//appliedMigrations returns times migrations were applied at by their versions,
+//none are applied if the table of applied migrations is missing
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]string, error) {
+	applied := make(map[int]string)
+	var tables int
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.TABLES
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, migrationsTable).Scan(&tables)
+	if err != nil || tables == 0 {
+		return applied, err
+	}
+	res, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+quoteIdentifier(migrationsTable))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+	for res.Next() {
+		var version int
+		var appliedAt string
+		err = res.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, res.Err()
+}
+
+//migrationTarget returns the version the command migrates to, up migrates to the last version,
+//down reverts the last applied migration and to migrates to the version to
+func migrationTarget(command string, to int, migrations []migration, applied map[int]string) (int, error) {
+	switch command {
+	case "up":
+		if len(migrations) == 0 {
+			return 0, nil
+		}
+		return migrations[len(migrations)-1].version, nil
+	case "down":
+		var versions []int
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		if len(versions) == 0 {
+			return 0, migrationError{"no migrations are applied"}
+		}
+		sort.Ints(versions)
+		if len(versions) == 1 {
+			return 0, nil
+		}
+		return versions[len(versions)-2], nil
+	case "to":
+		if to == 0 {
+			return 0, nil
+		}
+		for _, m := range migrations {
+			if m.version == to {
+				return to, nil
+			}
+		}
+		return 0, migrationError{fmt.Sprintf("unknown version %d", to)}
+	default:
+		return 0, migrationError{"unknown command " + command}
+	}
+}
+
+//runMigrations applies or reverts migrations by the command holding the lock of migrations
+//and returns ones it applied and reverted in their order, like "applied 1 create_tags"
+func runMigrations(ctx context.Context, db *sql.DB, migrations []migration, command string, to int) ([]string, error) {
+	var steps []string
+	err := withMigrationLock(ctx, db, migrationLockTimeout, func(conn *sql.Conn) error {
+		err := createMigrationsTable(ctx, conn)
+		if err != nil {
+			return err
+		}
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		target, err := migrationTarget(command, to, migrations, applied)
+		if err != nil {
+			return err
+		}
+
+		byVersion := make(map[int]migration, len(migrations))
+		for _, m := range migrations {
+			byVersion[m.version] = m
+		}
+		var reverted []int
+		for version := range applied {
+			if version > target {
+				reverted = append(reverted, version)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(reverted)))
+		for _, version := range reverted {
+			m, ok := byVersion[version]
+			if !ok || m.down == "" {
+				return migrationError{fmt.Sprintf("migration %d can't be reverted without its down file", version)}
+			}
+			err = execMigration(ctx, conn, m, m.down, "DELETE FROM "+quoteIdentifier(migrationsTable)+" WHERE version = ?", m.version)
+			if err != nil {
+				return err
+			}
+			steps = append(steps, "reverted "+m.String())
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok || m.version > target {
+				continue
+			}
+			err = execMigration(ctx, conn, m, m.up, "INSERT INTO "+quoteIdentifier(migrationsTable)+" (version, name, applied_at) VALUES (?, ?, NOW())", m.version, m.name)
+			if err != nil {
+				return err
+			}
+			steps = append(steps, "applied "+m.String())
+		}
+		return nil
+	})
+	return steps, err
+}
+
+//execMigration executes statements of the file of the migration and then the statement
+//recording it. MySQL commits DDL statements implicitly, so they aren't in a transaction
+func execMigration(ctx context.Context, conn *sql.Conn, m migration, path string, record string, args ...interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := newStatementScanner(file)
+	for executed := 1; ; executed++ {
+		stmt, err := scanner.next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			_, err = conn.ExecContext(ctx, stmt)
+		}
+		if err != nil {
+			return migrationStepError{migration: m, statement: executed, err: err}
+		}
+	}
+	_, err = conn.ExecContext(ctx, record, args...)
+	return err
+}
+
+//MigrationStatus is a migration with the time it was applied at
+type MigrationStatus struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	//AppliedAt is empty for pending migrations
+	AppliedAt string `json:"applied_at,omitempty"`
+}
+
+//migrationsStatus returns migrations of files and applied migrations missing in them
+func migrationsStatus(ctx context.Context, db *sql.DB, migrations []migration) ([]MigrationStatus, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status = append(status, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: applied[m.version]})
+		delete(applied, m.version)
+	}
+	for version, appliedAt := range applied {
+		status = append(status, MigrationStatus{Version: version, AppliedAt: appliedAt})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+//writeMigrationsStatus writes a line of every migration
+func writeMigrationsStatus(w io.Writer, status []MigrationStatus) error {
+	for _, m := range status {
+		state := "pending"
+		if m.AppliedAt != "" {
+			state = "applied at " + m.AppliedAt
+		}
+		name := m.Name
+		if name == "" {
+			name = "(missing files)"
+		}
+		_, err := fmt.Fprintf(w, "%d %s: %s\n", m.Version, name, state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//runMigrateCommand runs migrate [-dir dir] up|down|status|to N of the command line
+func runMigrateCommand(ctx context.Context, db *sql.DB, args []string, stdout io.Writer) error {
+	dir := "migrations"
+	if len(args) >= 2 && args[0] == "-dir" {
+		dir, args = args[1], args[2:]
+	}
+	if len(args) == 0 {
+		return migrationError{"usage: migrate [-dir dir] up|down|status|to N"}
+	}
+	migrations, err := loadMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	to := 0
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		status, err := migrationsStatus(ctx, db, migrations)
+		if err != nil {
+			return err
+		}
+		return writeMigrationsStatus(stdout, status)
+	case args[0] == "to" && len(args) == 2:
+		to, err = strconv.Atoi(args[1])
+		if err != nil {
+			return migrationError{"version must be an integer"}
+		}
+	case (args[0] == "up" || args[0] == "down") && len(args) == 1:
+	default:
+		return migrationError{"usage: migrate [-dir dir] up|down|status|to N"}
+	}
+
+	steps, err := runMigrations(ctx, db, migrations, args[0], to)
+	for _, step := range steps {
+		fmt.Fprintln(stdout, step)
+	}
+	if err == nil && len(steps) == 0 {
+		_, err = fmt.Fprintln(stdout, "no migrations to run")
+	}
+	return err
+}
+
+//WithMigrations sets the directory of migrations run by /_admin/migrations endpoints
+func WithMigrations(dir string) Option {
+	return func(l *Router) {
+		l.migrationsDir = dir
+	}
+}
+
+//migrationsRespError converts an error of migrations to an error of API
+func migrationsRespError(err error) RespError {
+	switch casted := err.(type) {
+	case migrationError:
+		return RespError{HTTPStatus: http.StatusBadRequest, Error: casted.Error()}
+	case migrationLockError:
+		return RespError{HTTPStatus: http.StatusConflict, Error: casted.Error()}
+	case migrationStepError:
+		rErr := statementError(casted.err)
+		if rErr.HTTPStatus != http.StatusInternalServerError {
+			rErr.Error = fmt.Sprintf("migration %s: statement %d: %s", casted.migration, casted.statement, rErr.Error)
+		}
+		return rErr
+	default:
+		return dbError(err)
+	}
+}
+
+//migrationsContext returns a context of migrations run by the request, it isn't canceled
+//when the client goes away, DDL statements can't be rolled back so a migration stopped
+//in the middle leaves the schema half changed
+func (l *Router) migrationsContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := l.routeTimeout(RouteSchemaChange)
+	if timeout <= 0 {
+		timeout = migrationsTimeout
+	}
+	return context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+}
+
+//serveMigrations serves GET /_admin/migrations with the status of migrations and
+//POST /_admin/migrations/up, /_admin/migrations/down and /_admin/migrations/to/N
+//running them, the schema is reloaded after migrations run
+func serveMigrations(w http.ResponseWriter, r *http.Request, l *Router, args []string) {
+	if l.migrationsDir == "" {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "migrations aren't configured"}.serve(w, r, l)
+		return
+	}
+	migrations, err := loadMigrations(l.migrationsDir)
+	if err != nil {
+		RespError{HTTPStatus: http.StatusInternalServerError, Error: "Internal Server Error"}.serve(w, r, l)
+		log.Println("can't load migrations:", err)
+		return
+	}
+	if r.Method == http.MethodGet {
+		ctx, cancel := l.requestContext(r, RouteSchemaChange)
+		defer cancel()
+		status, err := migrationsStatus(ctx, l.db, migrations)
+		if err != nil {
+			dbError(err).serve(w, r, l)
+			log.Println(err)
+			return
+		}
+		serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"migrations": status}})
+		return
+	}
+
+	to := 0
+	if args[0] == "to" {
+		to, err = strconv.Atoi(args[1])
+		if err != nil {
+			RespError{HTTPStatus: http.StatusBadRequest, Error: "version must be an integer"}.serve(w, r, l)
+			return
+		}
+	}
+	ctx, cancel := l.migrationsContext(r)
+	defer cancel()
+	steps, err := runMigrations(ctx, l.db, migrations, args[0], to)
+	if len(steps) > 0 {
+		//some migrations may have run before an error
+		if reloadErr := l.Reload(); reloadErr != nil {
+			log.Println("can't reload the schema:", reloadErr)
+		}
+	}
+	if err != nil {
+		log.Println("can't run migrations:", err)
+		migrationsRespError(err).serve(w, r, l)
+		return
+	}
+	if steps == nil {
+		steps = []string{}
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"steps": steps}})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+//encodeMsgpack encodes v as MessagePack, integers of rows stay integers
+func encodeMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeMsgpack(&buf, plainValue(v))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMsgpack(buf *bytes.Buffer, v interface{}) error {
+	switch casted := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if casted {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int64:
+		writeMsgpackInt(buf, casted)
+	case uint64:
+		if casted <= math.MaxInt64 {
+			writeMsgpackInt(buf, int64(casted))
+		} else {
+			buf.WriteByte(0xcf)
+			writeBigEndian(buf, casted, 8)
+		}
+	case float64:
+		buf.WriteByte(0xcb)
+		writeBigEndian(buf, math.Float64bits(casted), 8)
+	case string:
+		writeMsgpackHeader(buf, len(casted), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		buf.WriteString(casted)
+	case []byte:
+		writeMsgpackHeader(buf, len(casted), 0, -1, 0xc4, 0xc5, 0xc6)
+		buf.Write(casted)
+	case []interface{}:
+		writeMsgpackHeader(buf, len(casted), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range casted {
+			if err := writeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case plainObject:
+		writeMsgpackHeader(buf, len(casted), 0x80, 15, 0, 0xde, 0xdf)
+		for _, field := range casted {
+			if err := writeMsgpack(buf, field.Key); err != nil {
+				return err
+			}
+			if err := writeMsgpack(buf, field.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, v int64) {
+	switch {
+	case v >= 0 && v <= 127:
+		buf.WriteByte(byte(v))
+	case v < 0 && v >= -32:
+		buf.WriteByte(byte(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		writeBigEndian(buf, uint64(v), 2)
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		writeBigEndian(buf, uint64(v), 4)
+	default:
+		buf.WriteByte(0xd3)
+		writeBigEndian(buf, uint64(v), 8)
+	}
+}
+
+//writeMsgpackHeader writes a header of a string, binary, array or map of the length:
+//fixed is used for lengths up to fixedMax, then 8, 16 and 32 bit variants,
+//zero codes mean that a variant doesn't exist for the type
+func writeMsgpackHeader(buf *bytes.Buffer, length int, fixed byte, fixedMax int, code8, code16, code32 byte) {
+	switch {
+	case length <= fixedMax:
+		buf.WriteByte(fixed | byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		buf.WriteByte(code8)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(code16)
+		writeBigEndian(buf, uint64(length), 2)
+	default:
+		buf.WriteByte(code32)
+		writeBigEndian(buf, uint64(length), 4)
+	}
+}
+
+//writeBigEndian writes the lowest size bytes of v in the network order
+func writeBigEndian(buf *bytes.Buffer, v uint64, size int) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], v)
+	buf.Write(data[8-size:])
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+//openAPIVersion is a version of the OpenAPI Specification of generated documents
+const openAPIVersion = "3.1.0"
+
+//jsonObject is a member of generated JSON documents
+type jsonObject map[string]interface{}
+
+//recordSchema returns a JSON Schema of rows of the table, all fields are present in rows
+func recordSchema(table TableDesc) jsonObject {
+	properties := jsonObject{}
+	required := make([]string, 0)
+	for _, field := range table.getFieldsArray() {
+		properties[field.Name] = fieldSchema(field)
+		required = append(required, field.Name)
+	}
+	return jsonObject{"type": "object", "properties": properties, "required": required}
+}
+
+//inputSchema returns a JSON Schema of bodies creating or updating rows of the table,
+//the primary key is set by the database and missing fields get their defaults
+func inputSchema(table TableDesc) jsonObject {
+	properties := jsonObject{}
+	for _, field := range table.getFieldsArray() {
+		if field.IsPrimaryKey {
+			continue
+		}
+		properties[field.Name] = fieldSchema(field)
+	}
+	return jsonObject{"type": "object", "properties": properties}
+}
+
+//responseSchema returns a schema of the {"response": {...}} envelope
+func responseSchema(properties jsonObject) jsonObject {
+	return jsonObject{
+		"type": "object",
+		"properties": jsonObject{
+			"response": jsonObject{"type": "object", "properties": properties},
+		},
+	}
+}
+
+func schemaRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/schemas/" + name}
+}
+
+func responseRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/responses/" + name}
+}
+
+func jsonContent(schema jsonObject) jsonObject {
+	return jsonObject{contentTypeJSON: jsonObject{"schema": schema}}
+}
+
+func okResponse(description string, schema jsonObject) jsonObject {
+	return jsonObject{"description": description, "content": jsonContent(schema)}
+}
+
+//listResponse returns an answer of listed rows which are encoded by the format parameter
+//as JSON by the schema or as text and XLSX files
+func listResponse(description string, schema jsonObject) jsonObject {
+	response := okResponse(description, schema)
+	content := response["content"].(jsonObject)
+	content[contentTypeNDJSON] = jsonObject{"schema": jsonObject{"type": "string"}}
+	content[contentTypeCSV] = jsonObject{"schema": jsonObject{"type": "string"}}
+	content[contentTypeTSV] = jsonObject{"schema": jsonObject{"type": "string"}}
+	content[contentTypeXLSX] = jsonObject{"schema": jsonObject{"type": "string", "contentEncoding": "binary"}}
+	return response
+}
+
+//expandParameter returns the expand parameter of the table listing names of its relations,
+//nil is returned if the table has no relations
+func expandParameter(table TableDesc) jsonObject {
+	if len(table.relations) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(table.relations))
+	for _, rel := range table.relations {
+		names = append(names, rel.name)
+	}
+	return jsonObject{
+		"name":        "expand",
+		"in":          "query",
+		"description": "Relations embedded into rows: a parent row or null and an array of child rows",
+		"style":       "form",
+		"explode":     false,
+		"schema":      jsonObject{"type": "array", "items": jsonObject{"type": "string", "enum": names}},
+	}
+}
+
+//columnsParameter returns a query parameter listing comma separated names of the columns
+func columnsParameter(name string, description string, columns []string) jsonObject {
+	return jsonObject{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"style":       "form",
+		"explode":     false,
+		"schema":      jsonObject{"type": "array", "items": jsonObject{"type": "string", "enum": columns}},
+	}
+}
+
+//errorResponses returns references to responses of errors of the statuses
+func errorResponses(responses jsonObject, statuses ...string) jsonObject {
+	for _, status := range statuses {
+		responses[status] = responseRef("Error")
+	}
+	return responses
+}
+
+//openAPIDocument generates an OpenAPI document describing routes of every table of desc
+func openAPIDocument(desc DbDesc) jsonObject {
+	tableNames := make([]string, 0, len(desc.tables))
+	for name := range desc.tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	schemas := jsonObject{
+		"Error": jsonObject{
+			"type":       "object",
+			"properties": jsonObject{"error": jsonObject{"type": "string"}},
+			"required":   []string{"error"},
+		},
+		"Problem": jsonObject{
+			"type": "object",
+			"properties": jsonObject{
+				"type":     jsonObject{"type": "string"},
+				"title":    jsonObject{"type": "string"},
+				"status":   jsonObject{"type": "integer"},
+				"detail":   jsonObject{"type": "string"},
+				"instance": jsonObject{"type": "string"},
+				"errors": jsonObject{
+					"type": "array",
+					"items": jsonObject{
+						"type": "object",
+						"properties": jsonObject{
+							"field":  jsonObject{"type": "string"},
+							"detail": jsonObject{"type": "string"},
+						},
+					},
+				},
+			},
+			"required": []string{"type", "title", "status"},
+		},
+		"Facets": jsonObject{
+			"type":        "object",
+			"description": "The most frequent values of columns of the facets parameter by names of the columns",
+			"additionalProperties": jsonObject{
+				"type": "array",
+				"items": jsonObject{
+					"type": "object",
+					"properties": jsonObject{
+						"value": jsonObject{},
+						"count": jsonObject{"type": "integer"},
+					},
+				},
+			},
+		},
+		"ImportReport": jsonObject{
+			"type": "object",
+			"properties": jsonObject{
+				"inserted": jsonObject{"type": "integer"},
+				"valid":    jsonObject{"type": "integer"},
+				"dry_run":  jsonObject{"type": "boolean"},
+				"errors": jsonObject{
+					"type": "array",
+					"items": jsonObject{
+						"type": "object",
+						"properties": jsonObject{
+							"line":  jsonObject{"type": "integer"},
+							"field": jsonObject{"type": "string"},
+							"error": jsonObject{"type": "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	paths := jsonObject{
+		"/": jsonObject{
+			"get": jsonObject{
+				"operationId": "listTables",
+				"summary":     "List tables",
+				"responses": jsonObject{
+					"200": okResponse("Names of tables", responseSchema(jsonObject{
+						"tables": jsonObject{"type": "array", "items": jsonObject{"type": "string", "enum": tableNames}},
+						"read_only": jsonObject{
+							"type":                 "object",
+							"description":          "Kinds of read-only tables like views by their names",
+							"additionalProperties": jsonObject{"type": "string"},
+						},
+					})),
+				},
+			},
+		},
+	}
+
+	for _, name := range tableNames {
+		table := desc.tables[name]
+		schemas[name] = recordSchema(table)
+		schemas[name+"Input"] = inputSchema(table)
+
+		tablePath := jsonObject{
+			"get": jsonObject{
+				"operationId": "list_" + name,
+				"summary":     "List rows of " + name,
+				"parameters": []jsonObject{
+					{"$ref": "#/components/parameters/limit"},
+					{"$ref": "#/components/parameters/offset"},
+					{"$ref": "#/components/parameters/q"},
+					{"$ref": "#/components/parameters/filter"},
+					{"$ref": "#/components/parameters/format"},
+					{"$ref": "#/components/parameters/null"},
+				},
+				"responses": errorResponses(jsonObject{
+					"200": listResponse("Rows of "+name, responseSchema(jsonObject{
+						"records": jsonObject{"type": "array", "items": schemaRef(name)},
+						"facets":  schemaRef("Facets"),
+					})),
+				}, "400", "404", "504"),
+			},
+		}
+		paths["/"+name] = tablePath
+		columns := make([]string, 0, len(table.fields))
+		for _, field := range table.getFieldsArray() {
+			columns = append(columns, field.Name)
+		}
+		paths["/"+name+"/_aggregate"] = jsonObject{
+			"get": jsonObject{
+				"operationId": "aggregate_" + name,
+				"summary":     "Group rows of " + name + " and aggregate columns of every group",
+				"parameters": []jsonObject{
+					columnsParameter("group_by", "Grouped columns", columns),
+					columnsParameter("count", "Columns counted in every group, * counts rows", append([]string{"*"}, columns...)),
+					columnsParameter("sum", "Numeric columns summed in every group", columns),
+					columnsParameter("avg", "Numeric columns averaged in every group", columns),
+					columnsParameter("min", "Columns with minimums of every group", columns),
+					columnsParameter("max", "Columns with maximums of every group", columns),
+					{"$ref": "#/components/parameters/q"},
+					{"$ref": "#/components/parameters/filter"},
+					{"$ref": "#/components/parameters/groupLimit"},
+					{"$ref": "#/components/parameters/offset"},
+				},
+				"responses": errorResponses(jsonObject{
+					"200": okResponse("Grouped columns and aggregates named like count, max_id", responseSchema(jsonObject{
+						"records": jsonObject{"type": "array", "items": jsonObject{"type": "object"}},
+					})),
+				}, "400", "404", "504"),
+			},
+		}
+		paths["/"+name+"/_distinct/{column}"] = jsonObject{
+			"get": jsonObject{
+				"operationId": "distinct_" + name,
+				"summary":     "List distinct values of a column of " + name + " in ascending order",
+				"parameters": []jsonObject{
+					{
+						"name":     "column",
+						"in":       "path",
+						"required": true,
+						"schema":   jsonObject{"type": "string", "enum": columns},
+					},
+					{"$ref": "#/components/parameters/q"},
+					{"$ref": "#/components/parameters/filter"},
+					{"$ref": "#/components/parameters/groupLimit"},
+					{"$ref": "#/components/parameters/offset"},
+				},
+				"responses": errorResponses(jsonObject{
+					"200": okResponse("Distinct values", responseSchema(jsonObject{
+						"values": jsonObject{"type": "array"},
+					})),
+				}, "400", "404", "504"),
+			},
+		}
+		getList := tablePath["get"].(jsonObject)
+		getList["parameters"] = append(getList["parameters"].([]jsonObject),
+			columnsParameter("facets", "Columns with the most frequent values of listed rows counted", columns),
+			jsonObject{"$ref": "#/components/parameters/facet_size"},
+			jsonObject{"$ref": "#/components/parameters/sample"},
+			jsonObject{"$ref": "#/components/parameters/sample_pct"},
+			jsonObject{"$ref": "#/components/parameters/seed"},
+		)
+		expand := expandParameter(table)
+		if expand != nil {
+			getList["parameters"] = append(getList["parameters"].([]jsonObject), expand)
+		}
+		paths["/"+name+"/_schema"] = jsonObject{
+			"get": jsonObject{
+				"operationId": "schema_" + name,
+				"summary":     "Get a JSON Schema of rows of " + name + " for validation of forms",
+				"responses": jsonObject{
+					"200": jsonObject{
+						"description": "A JSON Schema of the draft 2020-12",
+						"content":     jsonObject{contentTypeSchemaJSON: jsonObject{"schema": jsonObject{"type": "object"}}},
+					},
+				},
+			},
+		}
+
+		if !table.isReadOnly() {
+			paths["/"+name+"/_import"] = jsonObject{
+				"post": jsonObject{
+					"operationId": "import_" + name,
+					"summary":     "Import rows of " + name + " from a CSV, TSV or NDJSON file",
+					"parameters": []jsonObject{
+						{
+							"name":        "dry_run",
+							"in":          "query",
+							"description": "Validate rows without inserting them",
+							"schema":      jsonObject{"type": "boolean", "default": false},
+						},
+						{"$ref": "#/components/parameters/null"},
+					},
+					"requestBody": jsonObject{
+						"required": true,
+						"content": jsonObject{
+							contentTypeCSV:    jsonObject{"schema": jsonObject{"type": "string"}},
+							contentTypeTSV:    jsonObject{"schema": jsonObject{"type": "string"}},
+							contentTypeNDJSON: jsonObject{"schema": jsonObject{"type": "string"}},
+						},
+					},
+					"responses": errorResponses(jsonObject{
+						"200": okResponse("A report of the import", jsonObject{
+							"type":       "object",
+							"properties": jsonObject{"response": schemaRef("ImportReport")},
+						}),
+					}, "400", "404", "409", "415", "504"),
+				},
+			}
+		}
+
+		keyField := table.getKeyField()
+		if keyField == nil {
+			continue
+		}
+		if !table.isReadOnly() {
+			tablePath["put"] = jsonObject{
+				"operationId": "create_" + name,
+				"summary":     "Create a row of " + name,
+				"requestBody": jsonObject{"required": true, "content": jsonContent(schemaRef(name + "Input"))},
+				"responses": errorResponses(jsonObject{
+					"200": okResponse("A key of the created row", responseSchema(jsonObject{
+						keyField.Name: fieldSchema(*keyField),
+					})),
+				}, "400", "404", "409", "415", "422", "504"),
+			}
+		}
+
+		idParameter := jsonObject{
+			"name":     "id",
+			"in":       "path",
+			"required": true,
+			"schema":   fieldSchema(FieldDesc{Type: keyField.Type}),
+		}
+		rowPath := jsonObject{
+			"parameters": []jsonObject{idParameter},
+			"get": jsonObject{
+				"operationId": "get_" + name,
+				"summary":     "Get a row of " + name + " by " + keyField.Name,
+				"responses": errorResponses(jsonObject{
+					"200": okResponse("The row", responseSchema(jsonObject{"record": schemaRef(name)})),
+				}, "404", "504"),
+			},
+		}
+		paths["/"+name+"/{id}"] = rowPath
+		if expand != nil {
+			rowPath["get"].(jsonObject)["parameters"] = []jsonObject{expand}
+		}
+		if !table.isReadOnly() {
+			rowPath["post"] = jsonObject{
+				"operationId": "update_" + name,
+				"summary":     "Update a row of " + name,
+				"requestBody": jsonObject{"required": true, "content": jsonContent(schemaRef(name + "Input"))},
+				"responses": errorResponses(jsonObject{
+					"200": okResponse("A number of updated rows", responseSchema(jsonObject{
+						"updated": jsonObject{"type": "integer"},
+					})),
+				}, "400", "404", "409", "415", "422", "504"),
+			}
+			rowPath["delete"] = jsonObject{
+				"operationId": "delete_" + name,
+				"summary":     "Delete a row of " + name,
+				"responses": errorResponses(jsonObject{
+					"200": okResponse("A number of deleted rows", responseSchema(jsonObject{
+						"deleted": jsonObject{"type": "integer"},
+					})),
+				}, "404", "409", "504"),
+			}
+		}
+
+		for _, rel := range table.relations {
+			operation := jsonObject{"operationId": "get_" + name + "_" + rel.name}
+			if rel.toParent {
+				operation["summary"] = "Get a row of " + rel.table + " referenced by a row of " + name
+				operation["responses"] = errorResponses(jsonObject{
+					"200": okResponse("The row", responseSchema(jsonObject{"record": schemaRef(rel.table)})),
+				}, "404", "504")
+			} else {
+				operation["summary"] = "List rows of " + rel.table + " referencing a row of " + name
+				operation["parameters"] = []jsonObject{
+					{"$ref": "#/components/parameters/limit"},
+					{"$ref": "#/components/parameters/offset"},
+					{"$ref": "#/components/parameters/q"},
+					{"$ref": "#/components/parameters/filter"},
+				}
+				operation["responses"] = errorResponses(jsonObject{
+					"200": okResponse("Rows of "+rel.table, responseSchema(jsonObject{
+						"records": jsonObject{"type": "array", "items": schemaRef(rel.table)},
+					})),
+				}, "400", "404", "504")
+			}
+			paths["/"+name+"/{id}/"+rel.name] = jsonObject{
+				"parameters": []jsonObject{idParameter},
+				"get":        operation,
+			}
+		}
+	}
+
+	return jsonObject{
+		"openapi": openAPIVersion,
+		"info":    jsonObject{"title": "db_explorer", "version": "1.0.0"},
+		"paths":   paths,
+		"components": jsonObject{
+			"schemas": schemas,
+			"parameters": jsonObject{
+				"limit": jsonObject{
+					"name":   "limit",
+					"in":     "query",
+					"schema": jsonObject{"type": "integer", "default": 5, "minimum": 0},
+				},
+				"offset": jsonObject{
+					"name":   "offset",
+					"in":     "query",
+					"schema": jsonObject{"type": "integer", "default": 0, "minimum": 0},
+				},
+				"q": jsonObject{
+					"name":        "q",
+					"in":          "query",
+					"description": "Words to search in text columns",
+					"schema":      jsonObject{"type": "string"},
+				},
+				"filter": jsonObject{
+					"name":        "filter",
+					"in":          "query",
+					"description": "A condition of rows, like (login==rvasily or email=like=*@example.com) and updated=isnull=true",
+					"schema":      jsonObject{"type": "string"},
+				},
+				"groupLimit": jsonObject{
+					"name":        "limit",
+					"in":          "query",
+					"description": "A number of groups, all of them are served if it's missing",
+					"schema":      jsonObject{"type": "integer", "minimum": 0},
+				},
+				"facet_size": jsonObject{
+					"name":        "facet_size",
+					"in":          "query",
+					"description": "A number of the most frequent values of every facet",
+					"schema":      jsonObject{"type": "integer", "default": defaultFacetSize, "minimum": 0},
+				},
+				"sample": jsonObject{
+					"name":        "sample",
+					"in":          "query",
+					"description": "A number of random rows, it can't be used with sample_pct",
+					"schema":      jsonObject{"type": "integer", "minimum": 1},
+				},
+				"sample_pct": jsonObject{
+					"name":        "sample_pct",
+					"in":          "query",
+					"description": "A percent of random rows, it can't be used with sample",
+					"schema":      jsonObject{"type": "number", "exclusiveMinimum": 0, "maximum": 100},
+				},
+				"seed": jsonObject{
+					"name":        "seed",
+					"in":          "query",
+					"description": "A seed of a sample, the same seed gives the same sample of the same rows",
+					"schema":      jsonObject{"type": "integer"},
+				},
+				"format": jsonObject{
+					"name":        "format",
+					"in":          "query",
+					"description": "A format of listed rows, the Accept header chooses it if it's missing",
+					"schema": jsonObject{
+						"type": "string",
+						"enum": []string{formatJSON, formatNDJSON, formatCSV, formatTSV, formatXLSX},
+					},
+				},
+				"null": jsonObject{
+					"name":        "null",
+					"in":          "query",
+					"description": "A representation of NULL in CSV, TSV and XLSX files",
+					"schema":      jsonObject{"type": "string"},
+				},
+			},
+			"responses": jsonObject{
+				"Error": jsonObject{
+					"description": "An error",
+					"content": jsonObject{
+						contentTypeJSON:    jsonObject{"schema": schemaRef("Error")},
+						contentTypeProblem: jsonObject{"schema": schemaRef("Problem")},
+					},
+				},
+			},
+		},
+	}
+}
+
+//serveOpenAPI serves an OpenAPI document of the current schema of the database
+func serveOpenAPI(w http.ResponseWriter, r *http.Request, l *Router) {
+	serveRepresentation(w, contentTypeJSON, http.StatusOK, openAPIDocument(l.desc))
+}
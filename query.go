@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+)
+
+//selectQuery builds a SELECT of rows of a table, conditions are joined by AND
+//and their values are passed as parameters of the query
+type selectQuery struct {
+	table string
+	//columns are selected expressions, all columns are selected if it's empty
+	columns []string
+	//columnArgs are parameters of columns, they precede parameters of conditions
+	columnArgs []interface{}
+	where      []string
+	args       []interface{}
+	groupBy    []string
+	orderBy    []string
+	//limit is ignored if it's negative
+	limit  int
+	offset int
+	//groupColumns make the limit and the offset apply to every combination of their values
+	groupColumns []string
+}
+
+func newSelectQuery(table string) *selectQuery {
+	return &selectQuery{table: table, limit: -1}
+}
+
+//filtered returns a new query of rows of the table matching conditions of the query
+func (q *selectQuery) filtered() *selectQuery {
+	return &selectQuery{
+		table: q.table,
+		where: append([]string{}, q.where...),
+		args:  append([]interface{}{}, q.args...),
+		limit: -1,
+	}
+}
+
+//whereEquals adds a condition that the column equals the value, nil matches NULL
+func (q *selectQuery) whereEquals(column string, value interface{}) {
+	if value == nil {
+		q.where = append(q.where, quoteIdentifier(column)+" IS NULL")
+		return
+	}
+	q.where = append(q.where, quoteIdentifier(column)+" = ?")
+	q.args = append(q.args, value)
+}
+
+//whereIn adds a condition that the column equals one of the values
+func (q *selectQuery) whereIn(column string, values []interface{}) {
+	if len(values) == 0 {
+		q.where = append(q.where, "FALSE")
+		return
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	q.where = append(q.where, quoteIdentifier(column)+" IN ("+placeholders+")")
+	q.args = append(q.args, values...)
+}
+
+//whereTuplesIn adds a condition that values of the columns equal one of the tuples
+func (q *selectQuery) whereTuplesIn(columns []string, tuples [][]interface{}) {
+	if len(columns) == 1 {
+		values := make([]interface{}, len(tuples))
+		for i, tuple := range tuples {
+			values[i] = tuple[0]
+		}
+		q.whereIn(columns[0], values)
+		return
+	}
+	if len(tuples) == 0 {
+		q.where = append(q.where, "FALSE")
+		return
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	placeholders := strings.TrimSuffix(strings.Repeat(placeholder+", ", len(tuples)), ", ")
+	q.where = append(q.where, "("+strings.Join(quoted, ", ")+") IN ("+placeholders+")")
+	for _, tuple := range tuples {
+		q.args = append(q.args, tuple...)
+	}
+}
+
+//addOrder sorts rows by the column
+func (q *selectQuery) addOrder(column string, descending bool) {
+	order := quoteIdentifier(column)
+	if descending {
+		order += " DESC"
+	}
+	q.orderBy = append(q.orderBy, order)
+}
+
+//limitPerGroup selects columns of the table and applies the limit and the offset
+//of the query to every combination of values of the columns
+func (q *selectQuery) limitPerGroup(table TableDesc, columns []string) {
+	q.columns = nil
+	for _, field := range table.getFieldsArray() {
+		q.columns = append(q.columns, quoteIdentifier(field.Name))
+	}
+	q.groupColumns = columns
+}
+
+//build returns the query and its parameters
+func (q *selectQuery) build() (string, []interface{}) {
+	var sb strings.Builder
+	columns := "*"
+	if len(q.columns) > 0 {
+		columns = strings.Join(q.columns, ", ")
+	}
+	grouped := len(q.groupColumns) > 0 && (q.limit >= 0 || q.offset > 0)
+	if grouped {
+		//rows are numbered inside their groups by a window function of a derived table
+		window := "PARTITION BY " + quoteIdentifiers(q.groupColumns)
+		if len(q.orderBy) > 0 {
+			window += " ORDER BY " + strings.Join(q.orderBy, ", ")
+		}
+		sb.WriteString("SELECT " + columns + " FROM (SELECT " + columns + ", ROW_NUMBER() OVER (" + window + ") AS `_group_row` FROM " + quoteIdentifier(q.table))
+	} else {
+		sb.WriteString("SELECT " + columns + " FROM " + quoteIdentifier(q.table))
+	}
+	if len(q.where) > 0 {
+		sb.WriteString(" WHERE " + strings.Join(q.where, " AND "))
+	}
+	if grouped {
+		sb.WriteString(") AS `grouped` WHERE `_group_row` > " + strconv.Itoa(q.offset))
+		if q.limit >= 0 {
+			sb.WriteString(" AND `_group_row` <= " + strconv.Itoa(q.offset+q.limit))
+		}
+	}
+	if len(q.groupBy) > 0 {
+		sb.WriteString(" GROUP BY " + strings.Join(q.groupBy, ", "))
+	}
+	if len(q.orderBy) > 0 {
+		sb.WriteString(" ORDER BY " + strings.Join(q.orderBy, ", "))
+	}
+	if q.limit >= 0 && len(q.groupColumns) == 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(q.limit) + " OFFSET " + strconv.Itoa(q.offset))
+	}
+	return sb.String(), append(append([]interface{}{}, q.columnArgs...), q.args...)
+}
+
+//queryRows runs the query and returns its rows decoded according to the table
+func queryRows(ctx context.Context, db queryer, table TableDesc, q *selectQuery) ([]map[string]interface{}, error) {
+	query, args := q.build()
+	res, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+
+	codec, err := newRowCodec(table, res)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0)
+	for res.Next() {
+		row, err := codec.scan(res)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, res.Err()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//ForeignKey is a foreign key of a table, Columns reference ReferencedColumns
+//of ReferencedTable in the same order
+type ForeignKey struct {
+	Name              string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+	OnUpdate          string
+	OnDelete          string
+}
+
+//relation leads from a row of a table to related rows of another table by a foreign key,
+//either to the parent row referenced by the row or to child rows referencing it
+type relation struct {
+	name string
+	//table is a name of the table of related rows
+	table    string
+	fk       ForeignKey
+	toParent bool
+}
+
+//getForeignKeys returns foreign keys of tables of the current database by names of the tables
+func getForeignKeys(db *sql.DB) (map[string][]ForeignKey, error) {
+	res, err := db.Query(`SELECT k.TABLE_NAME, k.CONSTRAINT_NAME, k.COLUMN_NAME,
+	k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, c.UPDATE_RULE, c.DELETE_RULE
+FROM information_schema.KEY_COLUMN_USAGE k
+JOIN information_schema.REFERENTIAL_CONSTRAINTS c
+	ON c.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND c.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+WHERE k.TABLE_SCHEMA = DATABASE() AND k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+
+	foreignKeys := make(map[string][]ForeignKey)
+	for res.Next() {
+		var table, name, column, refTable, refColumn, onUpdate, onDelete string
+		err = res.Scan(&table, &name, &column, &refTable, &refColumn, &onUpdate, &onDelete)
+		if err != nil {
+			return nil, err
+		}
+		keys := foreignKeys[table]
+		if len(keys) == 0 || keys[len(keys)-1].Name != name {
+			keys = append(keys, ForeignKey{Name: name, ReferencedTable: refTable, OnUpdate: onUpdate, OnDelete: onDelete})
+		}
+		last := &keys[len(keys)-1]
+		last.Columns = append(last.Columns, column)
+		last.ReferencedColumns = append(last.ReferencedColumns, refColumn)
+		foreignKeys[table] = keys
+	}
+	return foreignKeys, res.Err()
+}
+
+//linkRelations sets relations of tables of desc by their foreign keys. A parent is named
+//by the column of the key without the _id suffix, like user for items.user_id, or by its table,
+//children are named by their table. Names clashing with columns or other relations
+//get the columns of the key as a suffix, like items_by_author_id
+func linkRelations(desc DbDesc) {
+	tableNames := make([]string, 0, len(desc.tables))
+	for name := range desc.tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	relations := make(map[string][]relation)
+	for _, name := range tableNames {
+		for _, fk := range desc.tables[name].foreignKeys {
+			if _, ok := desc.tables[fk.ReferencedTable]; !ok {
+				continue
+			}
+			parentName := fk.ReferencedTable
+			if len(fk.Columns) == 1 && strings.HasSuffix(fk.Columns[0], "_id") && fk.Columns[0] != "_id" {
+				parentName = strings.TrimSuffix(fk.Columns[0], "_id")
+			}
+			relations[name] = append(relations[name], relation{name: parentName, table: fk.ReferencedTable, fk: fk, toParent: true})
+			relations[fk.ReferencedTable] = append(relations[fk.ReferencedTable], relation{name: name, table: name, fk: fk})
+		}
+	}
+
+	for _, name := range tableNames {
+		table := desc.tables[name]
+		table.relations = relations[name]
+		counts := make(map[string]int)
+		for _, rel := range table.relations {
+			counts[rel.name]++
+		}
+		for i, rel := range table.relations {
+			if _, isColumn := table.fields[rel.name]; isColumn || counts[rel.name] > 1 {
+				table.relations[i].name = rel.name + "_by_" + strings.Join(rel.fk.Columns, "_")
+			}
+		}
+		desc.tables[name] = table
+	}
+}
+
+//relation returns the relation of the table with the name, nil is returned if there isn't such one
+func (tDesc TableDesc) relation(name string) *relation {
+	for i := range tDesc.relations {
+		if tDesc.relations[i].name == name {
+			return &tDesc.relations[i]
+		}
+	}
+	return nil
+}
+
+//relatedQuery returns a query of rows related to the row,
+//nil is returned if a column of the foreign key of the row is NULL
+func (rel relation) relatedQuery(row map[string]interface{}) *selectQuery {
+	q := newSelectQuery(rel.table)
+	from, to := rel.relationColumns()
+	for i, column := range from {
+		value := row[column]
+		if value == nil {
+			return nil
+		}
+		q.whereEquals(to[i], value)
+	}
+	return q
+}
+
+//serveRelated serves rows related to the row of the table with the id:
+//the parent row for GET /items/5/user and child rows for GET /users/1/items
+func serveRelated(w http.ResponseWriter, r *http.Request, l *Router, tableName string, id string, relationName string) {
+	table, ok := l.desc.tables[tableName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	rel := table.relation(relationName)
+	keyField := table.getKeyField()
+	if rel == nil || keyField == nil {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown relation"}.serve(w, r, l)
+		return
+	}
+	relatedTable := l.desc.tables[rel.table]
+
+	route := RouteListRows
+	if rel.toParent {
+		route = RouteGetRow
+	}
+	ctx, cancel := l.requestContext(r, route)
+	defer cancel()
+
+	q := newSelectQuery(table.Name)
+	q.whereEquals(keyField.Name, id)
+	rows, err := queryRows(ctx, l.db, table, q)
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return
+	}
+	if len(rows) == 0 {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "record not found"}.serve(w, r, l)
+		return
+	}
+
+	q = rel.relatedQuery(rows[0])
+	if !rel.toParent {
+		if q == nil {
+			q = newSelectQuery(rel.table)
+			q.where = append(q.where, "FALSE")
+		}
+		serveRows(w, r, l, relatedTable, q, RouteListRows)
+		return
+	}
+
+	if q != nil {
+		rows, err = queryRows(ctx, l.db, relatedTable, q)
+		if err != nil {
+			dbError(err).serve(w, r, l)
+			log.Println(err)
+			return
+		}
+	}
+	if q == nil || len(rows) == 0 {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "record not found"}.serve(w, r, l)
+		return
+	}
+	if representation := l.representation(r); representation != "" {
+		serveRowResource(w, r, l, representation, relatedTable, rows[0])
+		return
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": map[string]interface{}{"record": rows[0]}})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+//schemaSnapshot is a description of the database with the GraphQL schema generated from it,
+//a request is served by the snapshot current when it comes even if the schema is reloaded
+type schemaSnapshot struct {
+	desc    DbDesc
+	graphql *gqlSchema
+	//checksum is a checksum of information_schema the desc was read with,
+	//it's empty if it wasn't computed
+	checksum string
+}
+
+func newSchemaSnapshot(desc DbDesc, checksum string) *schemaSnapshot {
+	return &schemaSnapshot{desc: desc, graphql: newGraphQLSchema(desc), checksum: checksum}
+}
+
+//snapshot returns the current schema
+func (l *Router) snapshot() *schemaSnapshot {
+	return l.schema.Load().(*schemaSnapshot)
+}
+
+//Reload reads the schema of the database again, requests which come after it
+//are served by the new schema and the ones being served keep the old one
+func (l *Router) Reload() error {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+
+	checksum, err := schemaChecksum(context.Background(), l.db)
+	if err != nil {
+		return err
+	}
+	desc, err := initExplorer(l.db)
+	if err != nil {
+		return err
+	}
+	l.schema.Store(newSchemaSnapshot(*desc, checksum))
+	return nil
+}
+
+//schemaChecksum returns a checksum of columns, keys and indexes of tables and parameters
+//of routines of the current database
+func schemaChecksum(ctx context.Context, db *sql.DB) (string, error) {
+	hash := sha256.New()
+	for _, query := range []string{
+		`SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, EXTRA
+FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY TABLE_NAME, ORDINAL_POSITION`,
+		`SELECT TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`,
+		`SELECT TABLE_NAME, INDEX_NAME, COLUMN_NAME, INDEX_TYPE
+FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`,
+		`SELECT ROUTINE_NAME, ROUTINE_TYPE
+FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = DATABASE()
+ORDER BY ROUTINE_NAME`,
+		`SELECT SPECIFIC_NAME, ORDINAL_POSITION, PARAMETER_MODE, PARAMETER_NAME, DTD_IDENTIFIER
+FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA = DATABASE()
+ORDER BY SPECIFIC_NAME, ORDINAL_POSITION`,
+	} {
+		err := hashRows(ctx, db, query, hash)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+//hashRows writes values of rows of the query to the hash
+func hashRows(ctx context.Context, db *sql.DB, query string, hash io.Writer) error {
+	res, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+	cols, err := res.Columns()
+	if err != nil {
+		return err
+	}
+	vals := make([]interface{}, len(cols))
+	for i := range vals {
+		vals[i] = new(sql.RawBytes)
+	}
+	for res.Next() {
+		err = res.Scan(vals...)
+		if err != nil {
+			return err
+		}
+		for _, val := range vals {
+			//lengths separate values so different rows can't give the same bytes
+			raw := *val.(*sql.RawBytes)
+			fmt.Fprintf(hash, "%d:%s;", len(raw), raw)
+		}
+		fmt.Fprint(hash, "\n")
+	}
+	return res.Err()
+}
+
+//WithSchemaPolling reloads the schema when a checksum of information_schema changes,
+//it's checked every interval until ctx is done
+func WithSchemaPolling(ctx context.Context, interval time.Duration) Option {
+	return func(l *Router) {
+		l.watchers = append(l.watchers, func(l *Router) {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				checksum, err := schemaChecksum(ctx, l.db)
+				if err != nil {
+					log.Println("can't check the schema:", err)
+					continue
+				}
+				if checksum == l.snapshot().checksum {
+					continue
+				}
+				if err = l.Reload(); err != nil {
+					log.Println("can't reload the schema:", err)
+				}
+			}
+		})
+	}
+}
+
+//WithReloadOnSignal reloads the schema when the process gets one of the signals,
+//like syscall.SIGHUP, until ctx is done
+func WithReloadOnSignal(ctx context.Context, signals ...os.Signal) Option {
+	return func(l *Router) {
+		l.watchers = append(l.watchers, func(l *Router) {
+			received := make(chan os.Signal, 1)
+			signal.Notify(received, signals...)
+			defer signal.Stop(received)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-received:
+				}
+				if err := l.Reload(); err != nil {
+					log.Println("can't reload the schema:", err)
+				}
+			}
+		})
+	}
+}
+
+//serveReload reloads the schema for POST /_admin/reload and serves names of tables of the new one
+func serveReload(w http.ResponseWriter, r *http.Request, l *Router) {
+	err := l.Reload()
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println(err)
+		return
+	}
+	serveAnswer(w, r, l, newRespTables(l.snapshot().desc))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+//Media types of opt-in representations of rows
+const (
+	contentTypeJSONAPI = "application/vnd.api+json"
+	contentTypeHAL     = "application/hal+json"
+)
+
+//WithBasePath sets a path the Router is mounted at, it prefixes links
+//of JSON:API and HAL representations
+func WithBasePath(basePath string) Option {
+	return func(l *Router) {
+		l.basePath = basePath
+	}
+}
+
+//representation returns contentTypeJSONAPI or contentTypeHAL if the client prefers
+//one of them to plain JSON, "" is returned for the {"response": ...} envelope
+func (l *Router) representation(r *http.Request) string {
+	chosen := negotiate(r.Header.Get("Accept"), []string{contentTypeJSON, contentTypeJSONAPI, contentTypeHAL})
+	if chosen == contentTypeJSONAPI || chosen == contentTypeHAL {
+		return chosen
+	}
+	return ""
+}
+
+//rowLink returns a link to the row of the table
+func (l *Router) rowLink(table TableDesc, row map[string]interface{}) string {
+	keyField := table.getKeyField()
+	if keyField == nil {
+		return ""
+	}
+	return l.basePath + "/" + url.PathEscape(table.Name) + "/" + url.PathEscape(fmt.Sprint(row[keyField.Name]))
+}
+
+//jsonAPIResource returns the row as a JSON:API resource object, the primary key
+//is its id and the other columns are its attributes
+func (l *Router) jsonAPIResource(table TableDesc, row map[string]interface{}) map[string]interface{} {
+	resource := map[string]interface{}{"type": table.Name}
+	attributes := make(map[string]interface{}, len(row))
+	keyField := table.getKeyField()
+	for name, value := range row {
+		if keyField != nil && name == keyField.Name {
+			resource["id"] = fmt.Sprint(value)
+			continue
+		}
+		attributes[name] = value
+	}
+	if keyField == nil {
+		resource["id"] = rowId(table, row)
+	}
+	resource["attributes"] = attributes
+	if self := l.rowLink(table, row); self != "" {
+		resource["links"] = map[string]string{"self": self}
+	}
+	return resource
+}
+
+//rowId returns an id of a row of a table without a primary key,
+//it's a JSON array of values of the columns in the order of the table
+func rowId(table TableDesc, row map[string]interface{}) string {
+	fields := table.getFieldsArray()
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		if value, ok := row[field.Name]; ok {
+			values = append(values, value)
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		log.Println("can't json.Marshal an id of a row:", err)
+	}
+	return string(data)
+}
+
+//halResource returns the row as a HAL resource with a self link
+func (l *Router) halResource(table TableDesc, row map[string]interface{}) map[string]interface{} {
+	resource := make(map[string]interface{}, len(row)+1)
+	for name, value := range row {
+		resource[name] = value
+	}
+	if self := l.rowLink(table, row); self != "" {
+		resource["_links"] = map[string]interface{}{"self": map[string]string{"href": self}}
+	}
+	return resource
+}
+
+//serveRowResource serves a single row in the representation
+func serveRowResource(w http.ResponseWriter, r *http.Request, l *Router, representation string, table TableDesc, row map[string]interface{}) {
+	var doc interface{}
+	if representation == contentTypeJSONAPI {
+		resource := l.jsonAPIResource(table, row)
+		doc = map[string]interface{}{"data": resource, "links": resource["links"]}
+	} else {
+		doc = l.halResource(table, row)
+	}
+	serveRepresentation(w, representation, http.StatusOK, doc)
+}
+
+//serveRepresentation writes the document as JSON of the media type
+func serveRepresentation(w http.ResponseWriter, mediaType string, status int, doc interface{}) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		log.Println("can't json.Marshal a document:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("can't serve:" + err.Error())
+	}
+}
+
+//jsonAPIErrors returns the error as a JSON:API document
+func (rErr RespError) jsonAPIErrors() map[string]interface{} {
+	apiErr := map[string]interface{}{
+		"status": strconv.Itoa(rErr.HTTPStatus),
+		"title":  http.StatusText(rErr.HTTPStatus),
+		"detail": rErr.Error,
+	}
+	if len(rErr.Fields) > 0 {
+		apiErr["source"] = map[string]string{"pointer": "/data/attributes/" + rErr.Fields[0].Field}
+	}
+	return map[string]interface{}{"errors": []interface{}{apiErr}}
+}
+
+//pageLinks returns self, first, prev and next links of a page of rows,
+//next is added when the page is full so there can be more rows,
+//an empty page of zero limit has no next one
+func (l *Router) pageLinks(r *http.Request, limit int, offset int, rows int) map[string]string {
+	link := func(offset int) string {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return l.basePath + r.URL.Path + "?" + query.Encode()
+	}
+	links := map[string]string{"self": link(offset), "first": link(0)}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links["prev"] = link(prev)
+	}
+	if limit > 0 && rows == limit {
+		links["next"] = link(offset + limit)
+	}
+	return links
+}
+
+//resourceEncoder streams rows as a JSON:API or HAL collection,
+//pagination links are written after the rows when their number is known
+type resourceEncoder struct {
+	listEncoder
+	r              *http.Request
+	l              *Router
+	table          TableDesc
+	representation string
+	limit, offset  int
+	//facets are written to meta of JSON:API and to the HAL resource if they're set
+	facets map[string]interface{}
+}
+
+func newResourceEncoder(w http.ResponseWriter, r *http.Request, l *Router, representation string, table TableDesc, limit int, offset int) *resourceEncoder {
+	enc := &resourceEncoder{
+		listEncoder:    listEncoder{w: w, contentType: representation, separator: ","},
+		r:              r,
+		l:              l,
+		table:          table,
+		representation: representation,
+		limit:          limit,
+		offset:         offset,
+	}
+	if representation == contentTypeJSONAPI {
+		enc.prefix = `{"data":[`
+	} else {
+		enc.prefix = `{"_embedded":{` + quoteJSON(table.Name) + `:[`
+	}
+	return enc
+}
+
+func (enc *resourceEncoder) writeRow(row map[string]interface{}) error {
+	if enc.representation == contentTypeJSONAPI {
+		return enc.listEncoder.writeRow(enc.l.jsonAPIResource(enc.table, row))
+	}
+	return enc.listEncoder.writeRow(enc.l.halResource(enc.table, row))
+}
+
+func (enc *resourceEncoder) finish() error {
+	links := enc.l.pageLinks(enc.r, enc.limit, enc.offset, enc.rows)
+	var linksDoc interface{} = links
+	enc.suffix = `],"links":`
+	if enc.representation == contentTypeHAL {
+		halLinks := make(map[string]interface{}, len(links))
+		for name, href := range links {
+			halLinks[name] = map[string]string{"href": href}
+		}
+		linksDoc = halLinks
+		enc.suffix = `]},"_links":`
+	}
+	if enc.facets != nil {
+		data, err := json.Marshal(enc.facets)
+		if err != nil {
+			return err
+		}
+		if enc.representation == contentTypeJSONAPI {
+			enc.suffix = `],"meta":{"facets":` + string(data) + `},"links":`
+		} else {
+			enc.suffix = `]},"facets":` + string(data) + `,"_links":`
+		}
+	}
+	data, err := json.Marshal(linksDoc)
+	if err != nil {
+		return err
+	}
+	enc.suffix += string(data) + "}"
+	return enc.listEncoder.finish()
+}
+
+func quoteJSON(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
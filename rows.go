@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+//rowCodec converts scanned columns of a table row to typed values
+//according to the description of the table
+type rowCodec struct {
+	table TableDesc
+	cols  []string
+	vals  []interface{}
+}
+
+func newRowCodec(table TableDesc, rows *sql.Rows) (*rowCodec, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]interface{}, len(cols))
+	for i := range cols {
+		vals[i] = new(sql.RawBytes)
+	}
+	return &rowCodec{table: table, cols: cols, vals: vals}, nil
+}
+
+//scan reads the current row of rows
+func (codec *rowCodec) scan(rows *sql.Rows) (map[string]interface{}, error) {
+	values, err := codec.scanValues(rows)
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]interface{}, len(codec.cols))
+	for i, col := range codec.cols {
+		row[col] = values[i]
+	}
+	return row, nil
+}
+
+//scanValues reads the current row of rows as values in the order of columns
+func (codec *rowCodec) scanValues(rows *sql.Rows) ([]interface{}, error) {
+	err := rows.Scan(codec.vals...)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(codec.cols))
+	for i, col := range codec.cols {
+		values[i] = codec.table.fields[col].decode(*codec.vals[i].(*sql.RawBytes))
+	}
+	return values, nil
+}
+
+//decode converts a raw value of the field to its type,
+//NULL is converted to nil
+func (field FieldDesc) decode(val sql.RawBytes) interface{} {
+	if val == nil {
+		return nil
+	}
+	if field.Type == "int" {
+		intVal, _ := strconv.Atoi(string(val))
+		return intVal
+	}
+	return string(val)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//routineFunction is a kind of stored functions in information_schema.ROUTINES,
+//other routines are procedures
+const routineFunction = "FUNCTION"
+
+//routineParam is a parameter of a stored routine, field describes its type
+//like a column so values of parameters are validated and decoded like values of columns
+type routineParam struct {
+	//mode is IN, OUT or INOUT, parameters of functions are IN
+	mode  string
+	field FieldDesc
+}
+
+//routineDesc is a stored procedure or function called by POST /_rpc/$name
+type routineDesc struct {
+	name string
+	//kind is PROCEDURE or FUNCTION
+	kind string
+	//params are parameters in their order
+	params []routineParam
+	//returns is a type of a value of a function
+	returns FieldDesc
+}
+
+//routineField returns a description of a value of a type of information_schema.PARAMETERS
+//like getFields does for a column
+func routineField(name string, dataType string, dtd string) FieldDesc {
+	field := FieldDesc{Name: name, RawType: dtd, Type: dataType, Nullable: true}
+	if strings.Contains(dataType, "int") {
+		field.Type = "int"
+	}
+	return field
+}
+
+//getRoutines returns stored procedures and functions of the current database by their names
+func getRoutines(db *sql.DB) (map[string]routineDesc, error) {
+	routines := make(map[string]routineDesc)
+	err := scanRows(db, `SELECT ROUTINE_NAME, ROUTINE_TYPE
+FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = DATABASE()`, func(res *sql.Rows) error {
+		var routine routineDesc
+		err := res.Scan(&routine.name, &routine.kind)
+		routines[routine.name] = routine
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//the value of a function is the parameter at position 0 without a name and a mode
+	err = scanRows(db, `SELECT SPECIFIC_NAME, ORDINAL_POSITION, PARAMETER_MODE, PARAMETER_NAME, DATA_TYPE, DTD_IDENTIFIER
+FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA = DATABASE()
+ORDER BY SPECIFIC_NAME, ORDINAL_POSITION`, func(res *sql.Rows) error {
+		var routineName, dataType, dtd string
+		var position int
+		var mode, name sql.NullString
+		err := res.Scan(&routineName, &position, &mode, &name, &dataType, &dtd)
+		if err != nil {
+			return err
+		}
+		routine, ok := routines[routineName]
+		if !ok {
+			return nil
+		}
+		if position == 0 {
+			routine.returns = routineField("result", dataType, dtd)
+		} else {
+			routine.params = append(routine.params, routineParam{mode: mode.String, field: routineField(name.String, dataType, dtd)})
+		}
+		routines[routineName] = routine
+		return nil
+	})
+	return routines, err
+}
+
+//scanRows calls scan for every row of the query
+func scanRows(db *sql.DB, query string, scan func(res *sql.Rows) error) error {
+	res, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+	for res.Next() {
+		err = scan(res)
+		if err != nil {
+			return err
+		}
+	}
+	return res.Err()
+}
+
+//paramsTable returns a table with the parameters of the routine as its fields,
+//so values of forms are converted to types of the parameters
+func (routine routineDesc) paramsTable() TableDesc {
+	fields := make(map[string]FieldDesc, len(routine.params))
+	for _, param := range routine.params {
+		fields[param.field.Name] = param.field
+	}
+	return TableDesc{Name: routine.name, fields: fields}
+}
+
+//rpcParamError is an error of parameters of a call
+type rpcParamError struct {
+	message string
+}
+
+func (pErr rpcParamError) Error() string {
+	return pErr.message
+}
+
+//args returns values of IN and INOUT parameters of the routine by their positions,
+//all of them are required and other parameters are rejected
+func (routine routineDesc) args(params map[string]interface{}) ([]interface{}, error) {
+	args := make([]interface{}, len(routine.params))
+	known := make(map[string]bool, len(routine.params))
+	for i, param := range routine.params {
+		known[param.field.Name] = true
+		if param.mode == "OUT" {
+			if _, ok := params[param.field.Name]; ok {
+				return nil, rpcParamError{"parameter " + param.field.Name + " is OUT"}
+			}
+			continue
+		}
+		value, ok := params[param.field.Name]
+		if !ok {
+			return nil, rpcParamError{"parameter " + param.field.Name + " is required"}
+		}
+		if err := param.field.validate(value); err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	for name := range params {
+		if !known[name] {
+			return nil, rpcParamError{"unknown parameter " + name}
+		}
+	}
+	return args, nil
+}
+
+//outVariable returns a name of a user variable of the OUT or INOUT parameter at the position
+func outVariable(position int) string {
+	return "@rpc_" + strconv.Itoa(position)
+}
+
+//callProcedure calls the procedure and returns its result sets and values of its OUT
+//and INOUT parameters by their names. They are passed in user variables of the session,
+//so the whole call uses one connection
+func callProcedure(ctx context.Context, db *sql.DB, routine routineDesc, args []interface{}) ([][]map[string]interface{}, map[string]interface{}, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	placeholders := make([]string, len(routine.params))
+	var inArgs []interface{}
+	var outVariables []string
+	for i, param := range routine.params {
+		if param.mode == "IN" {
+			placeholders[i] = "?"
+			inArgs = append(inArgs, args[i])
+			continue
+		}
+		//OUT variables are reset as the session may keep them from an earlier call
+		placeholders[i] = outVariable(i)
+		outVariables = append(outVariables, outVariable(i))
+		_, err = conn.ExecContext(ctx, "SET "+outVariable(i)+" = ?", args[i])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	res, err := conn.QueryContext(ctx, "CALL "+quoteIdentifier(routine.name)+"("+strings.Join(placeholders, ", ")+")", inArgs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	resultSets := make([][]map[string]interface{}, 0)
+	for hasSet := true; hasSet; hasSet = res.NextResultSet() {
+		columns, err := res.ColumnTypes()
+		if err != nil {
+			res.Close()
+			return nil, nil, err
+		}
+		//the status of the call ends results without columns
+		if len(columns) == 0 {
+			continue
+		}
+		fields := make([]FieldDesc, len(columns))
+		for i, column := range columns {
+			fields[i] = routineField(column.Name(), strings.ToLower(column.DatabaseTypeName()), "")
+		}
+		rows, err := scanDecoded(res, fields)
+		if err != nil {
+			res.Close()
+			return nil, nil, err
+		}
+		resultSets = append(resultSets, rows)
+	}
+	//NextResultSet stops at an error of a later statement of the procedure, like SIGNAL
+	if err = res.Err(); err != nil {
+		res.Close()
+		return nil, nil, err
+	}
+	err = res.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make(map[string]interface{}, len(outVariables))
+	if len(outVariables) == 0 {
+		return resultSets, out, nil
+	}
+	res, err = conn.QueryContext(ctx, "SELECT "+strings.Join(outVariables, ", "))
+	if err != nil {
+		return nil, nil, err
+	}
+	var fields []FieldDesc
+	for _, param := range routine.params {
+		if param.mode != "IN" {
+			fields = append(fields, param.field)
+		}
+	}
+	rows, err := scanDecoded(res, fields)
+	if closeErr := res.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) > 0 {
+		out = rows[0]
+	}
+	return resultSets, out, nil
+}
+
+//scanDecoded returns rows of the current result set decoded by the fields of their columns
+func scanDecoded(res *sql.Rows, fields []FieldDesc) ([]map[string]interface{}, error) {
+	vals := make([]interface{}, len(fields))
+	for i := range vals {
+		vals[i] = new(sql.RawBytes)
+	}
+	rows := make([]map[string]interface{}, 0)
+	for res.Next() {
+		err := res.Scan(vals...)
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			row[field.Name] = field.decode(*vals[i].(*sql.RawBytes))
+		}
+		rows = append(rows, row)
+	}
+	return rows, res.Err()
+}
+
+//callFunction returns a value of the function
+func callFunction(ctx context.Context, db *sql.DB, routine routineDesc, args []interface{}) (interface{}, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	var value sql.RawBytes
+	res, err := db.QueryContext(ctx, "SELECT "+quoteIdentifier(routine.name)+"("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = res.Close()
+		if err != nil {
+			log.Println("error while closing rows:", err)
+		}
+	}()
+	if !res.Next() {
+		return nil, res.Err()
+	}
+	err = res.Scan(&value)
+	if err != nil {
+		return nil, err
+	}
+	return routine.returns.decode(value), nil
+}
+
+//serveRPC calls a stored routine with parameters of a JSON body like {"a": 1, "b": "x"} or a form
+//for POST /_rpc/$name. A function answers {"response": {"result": value}} and
+//a procedure answers its result sets and values of OUT and INOUT parameters like
+//{"response": {"result_sets": [[{"a": 1}]], "out": {"total": 2}}}
+func serveRPC(w http.ResponseWriter, r *http.Request, l *Router, name string) {
+	routine, ok := l.desc.routines[name]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown procedure"}.serve(w, r, l)
+		return
+	}
+	params, err := decodeBody(r, routine.paramsTable())
+	if err == io.EOF {
+		params, err = map[string]interface{}{}, nil
+	}
+	var args []interface{}
+	if err == nil {
+		args, err = routine.args(params)
+	}
+	if pErr, ok := err.(rpcParamError); ok {
+		RespError{HTTPStatus: http.StatusBadRequest, Error: pErr.Error()}.serve(w, r, l)
+		return
+	}
+	if err != nil {
+		bodyError(err).serve(w, r, l)
+		return
+	}
+
+	ctx, cancel := l.requestContext(r, RouteRPC)
+	defer cancel()
+	var response map[string]interface{}
+	if routine.kind == routineFunction {
+		var value interface{}
+		value, err = callFunction(ctx, l.db, routine, args)
+		response = map[string]interface{}{"result": value}
+	} else {
+		var resultSets [][]map[string]interface{}
+		var out map[string]interface{}
+		resultSets, out, err = callProcedure(ctx, l.db, routine, args)
+		response = map[string]interface{}{"result_sets": resultSets, "out": out}
+	}
+	if err != nil {
+		dbError(err).serve(w, r, l)
+		log.Println("can't call", name+":", err)
+		return
+	}
+	serveAnswer(w, r, l, map[string]interface{}{"response": response})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	//maxSampleRounds limits queries of random keys of a sample
+	maxSampleRounds = 8
+	//maxSampleCandidates limits random keys looked up by a query
+	maxSampleCandidates = 5000
+)
+
+//sampling is a random sample of rows set by sample or sample_pct parameters,
+//the same seed gives the same sample of the same rows
+type sampling struct {
+	size    int
+	percent float64
+	seed    int64
+}
+
+//parseSampling returns a sampling of the query, nil is returned if it has neither
+//sample nor sample_pct
+func parseSampling(query url.Values) (*sampling, error) {
+	sizeStr, percentStr := query.Get("sample"), query.Get("sample_pct")
+	if sizeStr == "" && percentStr == "" {
+		return nil, nil
+	}
+	if sizeStr != "" && percentStr != "" {
+		return nil, samplingError{"sample and sample_pct can't be used together"}
+	}
+	s := &sampling{seed: time.Now().UnixNano()}
+	var err error
+	if sizeStr != "" {
+		s.size, err = strconv.Atoi(sizeStr)
+		if err != nil || s.size <= 0 {
+			return nil, samplingError{"sample must be a positive integer"}
+		}
+	} else {
+		s.percent, err = strconv.ParseFloat(percentStr, 64)
+		if err != nil || !(s.percent > 0 && s.percent <= 100) {
+			return nil, samplingError{"sample_pct must be a number from 0 to 100"}
+		}
+	}
+	if seedStr := query.Get("seed"); seedStr != "" {
+		s.seed, err = strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			return nil, samplingError{"seed must be an integer"}
+		}
+	}
+	return s, nil
+}
+
+//samplingError is returned for invalid parameters of a sample
+type samplingError struct {
+	message string
+}
+
+func (sErr samplingError) Error() string {
+	return sErr.message
+}
+
+//apply restricts the query to a sample of its rows no bigger than maxSize if it's positive.
+//Random keys between the least and the greatest key of the rows are looked up
+//for tables with an integer primary key, so a sample may be smaller if keys are too sparse.
+//Other tables are sampled by RAND
+func (s *sampling) apply(ctx context.Context, db queryer, table TableDesc, q *selectQuery, maxSize int) error {
+	keyField := table.getKeyField()
+	if keyField == nil || keyField.Type != "int" {
+		seed := strconv.FormatInt(s.seed, 10)
+		if s.percent > 0 {
+			q.where = append(q.where, "RAND("+seed+") < "+strconv.FormatFloat(s.percent/100, 'f', -1, 64))
+			q.limit = -1
+		} else {
+			q.orderBy = []string{"RAND(" + seed + ")"}
+			q.limit = s.size
+		}
+		if maxSize > 0 && (q.limit > maxSize || q.limit < 0) {
+			q.limit = maxSize
+		}
+		q.offset = 0
+		return nil
+	}
+
+	aggs := []aggregate{{function: "min", column: keyField.Name}, {function: "max", column: keyField.Name}, {function: "count", column: "*"}}
+	statsQuery := q.filtered()
+	statsQuery.selectAggregates(aggs)
+	stats, err := queryAggregates(ctx, db, table, statsQuery, aggs)
+	if err != nil {
+		return err
+	}
+	count, _ := stats[0]["count"].(int)
+	size := s.size
+	if s.percent > 0 {
+		size = int(math.Round(float64(count) * s.percent / 100))
+	}
+	if maxSize > 0 && size > maxSize {
+		size = maxSize
+	}
+	q.limit, q.offset = size, 0
+	if len(q.orderBy) == 0 {
+		q.addOrder(keyField.Name, false)
+	}
+	if size >= count {
+		return nil
+	}
+
+	keys, err := s.sampleKeys(ctx, db, table, q, keyField.Name, stats[0]["min_"+keyField.Name].(int), stats[0]["max_"+keyField.Name].(int), count, size)
+	if err != nil {
+		return err
+	}
+	q.whereIn(keyField.Name, keys)
+	return nil
+}
+
+//sampleKeys returns size keys of rows of the query drawn randomly from [min, max]
+//in rounds, every round looks up enough new keys to find the rest of the sample
+//if keys of count rows are spread uniformly
+func (s *sampling) sampleKeys(ctx context.Context, db queryer, table TableDesc, q *selectQuery, key string, min int, max int, count int, size int) ([]interface{}, error) {
+	random := rand.New(rand.NewSource(s.seed))
+	span := int64(max) - int64(min) + 1
+	density := float64(count) / float64(span)
+	tried := make(map[int64]bool)
+	found := make([]interface{}, 0, size)
+
+	for round := 0; round < maxSampleRounds && len(found) < size && int64(len(tried)) < span; round++ {
+		want := int(math.Ceil(float64(size-len(found))/density*1.25)) + 1
+		if want > maxSampleCandidates {
+			want = maxSampleCandidates
+		}
+		candidates := make([]interface{}, 0, want)
+		for len(candidates) < want && int64(len(tried)) < span {
+			candidate := random.Int63n(span)
+			if !tried[candidate] {
+				tried[candidate] = true
+				candidates = append(candidates, int(int64(min)+candidate))
+			}
+		}
+
+		keyQuery := q.filtered()
+		keyQuery.columns = []string{quoteIdentifier(key)}
+		keyQuery.whereIn(key, candidates)
+		rows, err := queryAggregates(ctx, db, table, keyQuery, []aggregate{{column: key}})
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[interface{}]bool, len(rows))
+		for _, row := range rows {
+			existing[row[key]] = true
+		}
+		//candidates are taken in the order they are drawn so the seed sets the sample
+		for _, candidate := range candidates {
+			if existing[candidate] && len(found) < size {
+				found = append(found, candidate)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].(int) < found[j].(int)
+	})
+	return found, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	//jsonSchemaDialect is a meta-schema of generated JSON Schemas
+	jsonSchemaDialect     = "https://json-schema.org/draft/2020-12/schema"
+	contentTypeSchemaJSON = "application/schema+json"
+)
+
+//typeArguments returns arguments of the raw type, like 255 of varchar(255)
+//or quoted members of enum('a','b'), "" is returned for types without them
+func (field FieldDesc) typeArguments() string {
+	start := strings.Index(field.RawType, "(")
+	end := strings.LastIndex(field.RawType, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return field.RawType[start+1 : end]
+}
+
+//baseType returns the raw type without arguments and attributes in lower case
+func (field FieldDesc) baseType() string {
+	baseType := strings.ToLower(field.RawType)
+	if i := strings.IndexAny(baseType, "( "); i >= 0 {
+		baseType = baseType[:i]
+	}
+	return baseType
+}
+
+//maxLength returns a maximal length of values of char and varchar fields,
+//zero is returned for other fields
+func (field FieldDesc) maxLength() int {
+	switch field.baseType() {
+	case "char", "varchar":
+		length, _ := strconv.Atoi(field.typeArguments())
+		return length
+	}
+	return 0
+}
+
+//enumValues returns members of an enum field, nil is returned for other fields.
+//A quote inside a member is either doubled or kept as is, so only a quote
+//followed by a comma or the end of the list closes a member
+func (field FieldDesc) enumValues() []string {
+	if field.baseType() != "enum" {
+		return nil
+	}
+	args := field.typeArguments()
+	values := make([]string, 0)
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(args); i++ {
+		c := args[i]
+		switch {
+		case c == '\'' && !quoted:
+			quoted = true
+		case c == '\'' && i+1 < len(args) && args[i+1] == '\'':
+			value.WriteByte(c)
+			i++
+		case c == '\'' && (i+1 == len(args) || args[i+1] == ','):
+			quoted = false
+			values = append(values, value.String())
+			value.Reset()
+		case c == '\\' && quoted && i+1 < len(args):
+			value.WriteByte(args[i+1])
+			i++
+		case quoted:
+			value.WriteByte(c)
+		}
+	}
+	return values
+}
+
+//isReadOnly reports whether values of the field are set by the database,
+//it's so for auto-increment and generated columns
+func (field FieldDesc) isReadOnly() bool {
+	extra := strings.ToLower(field.Extra)
+	return strings.Contains(extra, "auto_increment") || strings.Contains(extra, "generated")
+}
+
+//fieldSchema returns a JSON Schema of values of the field
+func fieldSchema(field FieldDesc) jsonObject {
+	var schemaType string
+	switch {
+	case field.Type == "int":
+		schemaType = "integer"
+	case field.isFloat():
+		schemaType = "number"
+	default:
+		schemaType = "string"
+	}
+	schema := jsonObject{"type": schemaType}
+	if field.Nullable {
+		schema["type"] = []string{schemaType, "null"}
+	}
+	if maxLength := field.maxLength(); maxLength > 0 {
+		schema["maxLength"] = maxLength
+	}
+	if values := field.enumValues(); values != nil {
+		enum := make([]interface{}, 0, len(values)+1)
+		for _, value := range values {
+			enum = append(enum, value)
+		}
+		if field.Nullable {
+			enum = append(enum, nil)
+		}
+		schema["enum"] = enum
+	}
+	if strings.Contains(strings.ToLower(field.RawType), "unsigned") {
+		schema["minimum"] = 0
+	}
+	if field.isReadOnly() {
+		schema["readOnly"] = true
+	}
+	return schema
+}
+
+//tableSchema returns a JSON Schema of rows of the table for validation of forms,
+//fields which aren't nullable, aren't set by the database and have no default are required
+func (l *Router) tableSchema(table TableDesc) jsonObject {
+	properties := jsonObject{}
+	required := make([]string, 0)
+	for _, field := range table.getFieldsArray() {
+		properties[field.Name] = fieldSchema(field)
+		if !field.Nullable && !field.isReadOnly() && !field.Default.Valid {
+			required = append(required, field.Name)
+		}
+	}
+	return jsonObject{
+		"$schema":    jsonSchemaDialect,
+		"$id":        l.basePath + "/" + table.Name + "/_schema",
+		"title":      table.Name,
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+//serveTableSchema serves a JSON Schema of rows of the table
+func serveTableSchema(w http.ResponseWriter, r *http.Request, l *Router, tableName string) {
+	table, ok := l.desc.tables[tableName]
+	if !ok {
+		RespError{HTTPStatus: http.StatusNotFound, Error: "unknown table"}.serve(w, r, l)
+		return
+	}
+	serveRepresentation(w, contentTypeSchemaJSON, http.StatusOK, l.tableSchema(table))
+}
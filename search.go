@@ -0,0 +1,212 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//snippetContext is a number of characters around a found term in a highlighted snippet
+const snippetContext = 30
+
+//isText reports whether the field stores text searched by LIKE
+func (field FieldDesc) isText() bool {
+	return strings.Contains(field.Type, "char") || strings.Contains(field.Type, "text")
+}
+
+//textSearch is a search of rows by words of the q parameter, like ?q=memcache.
+//FULLTEXT indexes of the table are used if it has them, otherwise all text columns
+//are searched by LIKE for every word
+type textSearch struct {
+	query string
+	terms []string
+	//fullText are columns of FULLTEXT indexes of the table
+	fullText [][]string
+	//columns are text columns of the table, they are highlighted
+	columns []string
+	//score and highlight are set by parameters of the same names
+	score     bool
+	highlight bool
+}
+
+//newTextSearch returns a search of the table by the query, nil is returned if it hasn't q
+func newTextSearch(query url.Values, table TableDesc) (*textSearch, error) {
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		return nil, nil
+	}
+	search := &textSearch{
+		query:    q,
+		terms:    strings.Fields(q),
+		fullText: table.fullTextIndexes,
+	}
+	search.score, _ = strconv.ParseBool(query.Get("score"))
+	search.highlight, _ = strconv.ParseBool(query.Get("highlight"))
+	for _, field := range table.getFieldsArray() {
+		if field.isText() {
+			search.columns = append(search.columns, field.Name)
+		}
+	}
+	if len(search.columns) == 0 && len(search.fullText) == 0 {
+		return nil, searchError{"table has no text columns"}
+	}
+	return search, nil
+}
+
+//searchError is returned for searches of tables without text columns
+type searchError struct {
+	message string
+}
+
+func (sErr searchError) Error() string {
+	return sErr.message
+}
+
+//escapeLike escapes wildcards of a pattern of LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+//conditions returns alternatives matching rows and their parameters:
+//MATCH of every FULLTEXT index or LIKE of every text column for every word
+func (search *textSearch) conditions() ([][]string, [][]interface{}) {
+	var groups [][]string
+	var args [][]interface{}
+	if len(search.fullText) > 0 {
+		var group []string
+		var groupArgs []interface{}
+		for _, columns := range search.fullText {
+			quoted := make([]string, len(columns))
+			for i, column := range columns {
+				quoted[i] = quoteIdentifier(column)
+			}
+			group = append(group, "MATCH("+strings.Join(quoted, ", ")+") AGAINST(? IN NATURAL LANGUAGE MODE)")
+			groupArgs = append(groupArgs, search.query)
+		}
+		return append(groups, group), append(args, groupArgs)
+	}
+	for _, term := range search.terms {
+		var group []string
+		var groupArgs []interface{}
+		for _, column := range search.columns {
+			group = append(group, quoteIdentifier(column)+" LIKE ?")
+			groupArgs = append(groupArgs, "%"+escapeLike(term)+"%")
+		}
+		groups = append(groups, group)
+		args = append(args, groupArgs)
+	}
+	return groups, args
+}
+
+//where adds a condition matching rows found by the search to the query
+func (search *textSearch) where(q *selectQuery) {
+	groups, args := search.conditions()
+	for i, group := range groups {
+		q.where = append(q.where, "("+strings.Join(group, " OR ")+")")
+		q.args = append(q.args, args[i]...)
+	}
+}
+
+//rank adds a relevance score of rows to the query and sorts them by it:
+//the sum of MATCH scores or a number of columns containing words
+func (search *textSearch) rank(q *selectQuery) {
+	groups, args := search.conditions()
+	var terms []string
+	for i, group := range groups {
+		for _, condition := range group {
+			//LIKE of NULL is NULL
+			terms = append(terms, "COALESCE("+condition+", 0)")
+		}
+		q.columnArgs = append(q.columnArgs, args[i]...)
+	}
+	q.columns = []string{"*", "(" + strings.Join(terms, " + ") + ") AS `_score`"}
+	q.orderBy = append([]string{"`_score` DESC"}, q.orderBy...)
+}
+
+//decorate sets the score and highlighted snippets of a found row if they're requested
+func (search *textSearch) decorate(row map[string]interface{}) {
+	if search.score {
+		row["_score"], _ = strconv.ParseFloat(exportValue(row["_score"], "0"), 64)
+	} else {
+		delete(row, "_score")
+	}
+	if !search.highlight {
+		return
+	}
+	highlights := make(map[string]interface{})
+	for _, column := range search.columns {
+		if value, ok := row[column].(string); ok {
+			if snippet, found := highlightSnippet(value, search.terms); found {
+				highlights[column] = snippet
+			}
+		}
+	}
+	row["_highlights"] = highlights
+}
+
+//highlightSnippet returns an HTML snippet of the text around the first found term,
+//terms in it are wrapped by em, false is returned if the text doesn't contain them
+func highlightSnippet(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	lowerTerms := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		lowerTerms = append(lowerTerms, []rune(strings.ToLower(term)))
+	}
+
+	//termAt returns a length of a term found at the position or 0
+	termAt := func(pos int) int {
+		longest := 0
+		for _, term := range lowerTerms {
+			if len(term) > longest && pos+len(term) <= len(lower) && string(lower[pos:pos+len(term)]) == string(term) {
+				longest = len(term)
+			}
+		}
+		return longest
+	}
+
+	first := -1
+	for i := range lower {
+		if termAt(i) > 0 {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+	start := first - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	end := first + termAt(first) + snippetContext
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; {
+		if length := termAt(i); length > 0 {
+			if i+length > end {
+				end = i + length
+			}
+			sb.WriteString("<em>" + html.EscapeString(string(runes[i:i+length])) + "</em>")
+			i += length
+			continue
+		}
+		sb.WriteString(html.EscapeString(string(runes[i])))
+		i++
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String(), true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+const (
+	//defaultLimit is a number of listed rows if the client doesn't set the limit
+	defaultLimit = 5
+	//defaultMaxLimit is a cap on the limit of listed rows if WithMaxLimit isn't used
+	defaultMaxLimit = 1000
+)
+
+//WithMaxLimit sets a hard cap on the limit of listed rows,
+//bigger limits are reduced to the cap, zero means no cap
+func WithMaxLimit(maxLimit int) Option {
+	return func(l *Router) {
+		l.maxLimit = maxLimit
+	}
+}
+
+//rowEncoder writes rows of a list answer one by one as they are scanned.
+//Nothing is written until the first row, so errors which happen before it
+//can still be served with a proper status
+type rowEncoder interface {
+	writeRow(row map[string]interface{}) error
+	//finish writes the end of the answer
+	finish() error
+	//isStarted reports whether a part of the answer is written
+	isStarted() bool
+}
+
+//listEncoder writes rows as JSON values
+type listEncoder struct {
+	w           http.ResponseWriter
+	contentType string
+	//prefix and suffix surround all rows, separator is written between rows
+	//and terminator after each row
+	prefix, separator, terminator, suffix string
+	started                               bool
+	rows                                  int
+	//hasResponse is set for the {"response": ...} answer which can hold facets
+	hasResponse bool
+}
+
+//newJSONEncoder returns an encoder of the {"response": {"records": [...]}} answer
+func newJSONEncoder(w http.ResponseWriter) *listEncoder {
+	return &listEncoder{
+		w:           w,
+		contentType: contentTypeJSON,
+		prefix:      `{"response":{"records":[`,
+		separator:   ",",
+		suffix:      "]}}",
+		hasResponse: true,
+	}
+}
+
+//newNDJSONEncoder returns an encoder of newline delimited JSON
+func newNDJSONEncoder(w http.ResponseWriter) *listEncoder {
+	return &listEncoder{w: w, contentType: contentTypeNDJSON, terminator: "\n"}
+}
+
+func (enc *listEncoder) start() error {
+	enc.started = true
+	enc.w.Header().Set("Content-Type", enc.contentType)
+	enc.w.WriteHeader(http.StatusOK)
+	_, err := enc.w.Write([]byte(enc.prefix))
+	return err
+}
+
+func (enc *listEncoder) isStarted() bool {
+	return enc.started
+}
+
+//writeRow writes the row, the answer is started if it's the first row
+func (enc *listEncoder) writeRow(row map[string]interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if !enc.started {
+		err = enc.start()
+		if err != nil {
+			return err
+		}
+	}
+	if enc.rows > 0 {
+		data = append([]byte(enc.separator), data...)
+	}
+	data = append(data, enc.terminator...)
+	enc.rows++
+	_, err = enc.w.Write(data)
+	return err
+}
+
+func (enc *listEncoder) finish() error {
+	if !enc.started {
+		err := enc.start()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := enc.w.Write([]byte(enc.suffix))
+	return err
+}
+
+//bufferedEncoder collects rows and serves them by serveAnswer,
+//it's used for registered encoders which don't support streaming
+type bufferedEncoder struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	l    *Router
+	rows []interface{}
+	//facets are served along with rows if they're set
+	facets map[string]interface{}
+}
+
+func (enc *bufferedEncoder) writeRow(row map[string]interface{}) error {
+	enc.rows = append(enc.rows, row)
+	return nil
+}
+
+func (enc *bufferedEncoder) finish() error {
+	response := map[string]interface{}{"records": enc.rows}
+	if enc.facets != nil {
+		response["facets"] = enc.facets
+	}
+	serveAnswer(enc.w, enc.r, enc.l, map[string]interface{}{"response": response})
+	return nil
+}
+
+func (enc *bufferedEncoder) isStarted() bool {
+	return false
+}
+
+//failStream serves the error if the answer isn't started yet,
+//otherwise the connection is aborted so the client doesn't take
+//a truncated answer for a complete one
+func failStream(w http.ResponseWriter, r *http.Request, l *Router, enc rowEncoder, err error) {
+	log.Println("can't stream rows:", err)
+	if !enc.isStarted() {
+		dbError(err).serve(w, r, l)
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+//Names of routes which can have their own timeouts
+const (
+	RouteListRows  = "list_rows"
+	RouteGetRow    = "get_row"
+	RouteCreateRow = "create_row"
+	RouteUpdateRow = "update_row"
+	RouteDeleteRow = "delete_row"
+	RouteImport    = "import"
+	RouteDump      = "dump"
+	RouteRestore   = "restore"
+	RouteGraphQL   = "graphql"
+	RouteRPC       = "rpc"
+	//RouteSchemaChange is a route of admin endpoints changing the schema
+	RouteSchemaChange = "schema_change"
+)
+
+//WithTimeout limits time of database calls of every route
+//which doesn't have its own timeout, zero means no limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(l *Router) {
+		l.defaultTimeout = timeout
+	}
+}
+
+//WithRouteTimeout limits time of database calls of the route
+func WithRouteTimeout(route string, timeout time.Duration) Option {
+	return func(l *Router) {
+		if l.timeouts == nil {
+			l.timeouts = make(map[string]time.Duration)
+		}
+		l.timeouts[route] = timeout
+	}
+}
+
+//routeTimeout returns a timeout of the route, zero means no limit
+func (l *Router) routeTimeout(route string) time.Duration {
+	timeout, ok := l.timeouts[route]
+	if !ok {
+		timeout = l.defaultTimeout
+	}
+	return timeout
+}
+
+//requestContext returns a context of the request limited by a timeout of the route,
+//the context is canceled when the client goes away as well
+func (l *Router) requestContext(r *http.Request, route string) (context.Context, context.CancelFunc) {
+	timeout := l.routeTimeout(route)
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
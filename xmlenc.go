@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+//problemXMLNamespace is a namespace of application/problem+xml documents
+const problemXMLNamespace = "urn:ietf:rfc:7807"
+
+//encodeXML encodes v as XML the way RFC 7807 does for problems: members of objects
+//are elements named by their keys, items of arrays are <i> elements and
+//nulls are empty elements with nil="true". A single member object,
+//like {"response": ...}, becomes the root element
+func encodeXML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+
+	if problem, ok := v.(Problem); ok {
+		buf.WriteString(`<problem xmlns="` + problemXMLNamespace + `">`)
+		for _, field := range plainValue(problem).(plainObject) {
+			writeXMLElement(&buf, field.Key, field.Value)
+		}
+		buf.WriteString(`</problem>`)
+		return buf.Bytes(), nil
+	}
+
+	plain := plainValue(v)
+	if obj, ok := plain.(plainObject); ok && len(obj) == 1 {
+		writeXMLElement(&buf, obj[0].Key, obj[0].Value)
+	} else {
+		writeXMLElement(&buf, "result", plain)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(buf *bytes.Buffer, name string, v interface{}) {
+	name = xmlName(name)
+	if v == nil {
+		buf.WriteString("<" + name + ` nil="true"/>`)
+		return
+	}
+	buf.WriteString("<" + name + ">")
+	switch casted := v.(type) {
+	case plainObject:
+		for _, field := range casted {
+			writeXMLElement(buf, field.Key, field.Value)
+		}
+	case []interface{}:
+		for _, item := range casted {
+			writeXMLElement(buf, "i", item)
+		}
+	case []byte:
+		buf.WriteString(base64.StdEncoding.EncodeToString(casted))
+	case string:
+		buf.WriteString(xmlEscape(casted))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(casted, 'g', -1, 64))
+	default:
+		buf.WriteString(xmlEscape(fmt.Sprint(casted)))
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+//xmlName makes a valid name of an element from a key, unsupported characters
+//are replaced by underscores and names which can't start an element are prefixed by it
+func xmlName(key string) string {
+	name := []rune(key)
+	if len(name) == 0 || !(name[0] == '_' || unicode.IsLetter(name[0])) {
+		name = append([]rune{'_'}, name...)
+	}
+	for i, c := range name {
+		if !(c == '_' || c == '-' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)) {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}